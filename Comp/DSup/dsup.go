@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
 	"math/big"
@@ -29,6 +30,41 @@ type CRS struct {
 	g_, h_ *bls12381.G2Affine
 }
 
+// Domain separation tags and seeds of the CRS. g and g_ are the standard
+// generators, h and h_ are hashed with RFC 9380, so nobody knows log_g(h) or
+// log_g_(h_).
+const (
+	g1DST  = "DSup-V01-CS01-with-BLS12381G1_XMD:SHA-256_SSWU_RO_"
+	g2DST  = "DSup-V01-CS01-with-BLS12381G2_XMD:SHA-256_SSWU_RO_"
+	hSeed  = "CRS/h"
+	h_Seed = "CRS/h_"
+)
+
+func Setup() (*CRS, error) {
+	_, _, g1, g2 := bls12381.Generators()
+	h, err := bls12381.HashToG1([]byte(hSeed), []byte(g1DST))
+	if err != nil {
+		return nil, err
+	}
+	h_, err := bls12381.HashToG2([]byte(h_Seed), []byte(g2DST))
+	if err != nil {
+		return nil, err
+	}
+	return &CRS{&g1, &h, &g2, &h_}, nil
+}
+
+// VerifyCRS recomputes the generators of crs from their seeds
+func VerifyCRS(crs *CRS) error {
+	crs_, err := Setup()
+	if err != nil {
+		return err
+	}
+	if !crs.g.Equal(crs_.g) || !crs.h.Equal(crs_.h) || !crs.g_.Equal(crs_.g_) || !crs.h_.Equal(crs_.h_) {
+		return errors.New("crs is not the nothing-up-my-sleeve one")
+	}
+	return nil
+}
+
 func (user *User) GenDSup(crs *CRS, tpk *bls12381.G1Affine, lpk *bls12381.G2Affine) (*DSup, error) {
 	order := bls12381.ID.ScalarField()
 
@@ -79,24 +115,6 @@ func Link(crs *CRS, dsup *DSup, lskU *bls12381.G2Affine) error {
 	return fmt.Errorf("not equal")
 }
 
-func getRandomG1() *bls12381.G1Affine {
-	order := bls12381.ID.ScalarField()
-	r, err := rand.Int(rand.Reader, order)
-	if err != nil {
-		panic(err)
-	}
-	return new(bls12381.G1Affine).ScalarMultiplicationBase(r)
-}
-
-func getRandomG2() *bls12381.G2Affine {
-	order := bls12381.ID.ScalarField()
-	r, err := rand.Int(rand.Reader, order)
-	if err != nil {
-		panic(err)
-	}
-	return new(bls12381.G2Affine).ScalarMultiplicationBase(r)
-}
-
 func GenerateRecords(crs *CRS, user *User, sup *Supervisor, total, rate int) ([]DSup, error) {
 	order := bls12381.ID.ScalarField()
 	groups := make([]DSup, total)
@@ -141,10 +159,12 @@ func traceSP(group []DSup, crs *CRS, lskU *bls12381.G2Affine) ([]int, error) {
 }
 
 func traceDSupTest(n, total, rate int) []time.Duration {
-	_, _, g1, g2 := bls12381.Generators()
 	order := bls12381.ID.ScalarField()
 
-	crs := &CRS{&g1, getRandomG1(), &g2, getRandomG2()}
+	crs, err := Setup()
+	if err != nil {
+		panic(err)
+	}
 
 	// User
 	usk, err := rand.Int(rand.Reader, order)
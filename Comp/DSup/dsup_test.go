@@ -8,10 +8,14 @@ import (
 )
 
 func TestDSup(t *testing.T) {
-	_, _, g1, g2 := bls12381.Generators()
 	order := bls12381.ID.ScalarField()
 
-	crs := &CRS{&g1, getRandomG1(), &g2, getRandomG2()}
+	crs, err := Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, VerifyCRS(crs))
+	assert.NotNil(t, VerifyCRS(&CRS{crs.g, crs.g, crs.g_, crs.h_}))
 
 	// User1
 	usk1, err := rand.Int(rand.Reader, order)
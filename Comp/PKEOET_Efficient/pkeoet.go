@@ -43,8 +43,42 @@ type CT struct {
 	X, Y   *bls12381.GT
 }
 
+// Domain separation tags and seeds of the public parameters. Every generator
+// is hashed with RFC 9380, so nobody knows a discrete log between g and h.
+const (
+	g1DST    = "PKEOET-V01-CS01-with-BLS12381G1_XMD:SHA-256_SSWU_RO_"
+	g2DST    = "PKEOET-V01-CS01-with-BLS12381G2_XMD:SHA-256_SSWU_RO_"
+	gSeed    = "Para/g"
+	hSeed    = "Para/h"
+	zetaSeed = "Para/zeta"
+)
+
 func Setup() (*Para, error) {
-	return &Para{getRandomG1(), getRandomG1(), getRandomG2()}, nil
+	g, err := bls12381.HashToG1([]byte(gSeed), []byte(g1DST))
+	if err != nil {
+		return nil, err
+	}
+	h, err := bls12381.HashToG1([]byte(hSeed), []byte(g1DST))
+	if err != nil {
+		return nil, err
+	}
+	zeta, err := bls12381.HashToG2([]byte(zetaSeed), []byte(g2DST))
+	if err != nil {
+		return nil, err
+	}
+	return &Para{&g, &h, &zeta}, nil
+}
+
+// VerifyCRS recomputes the public parameters from their seeds
+func VerifyCRS(para *Para) error {
+	para_, err := Setup()
+	if err != nil {
+		return err
+	}
+	if !para.g.Equal(para_.g) || !para.h.Equal(para_.h) || !para.zeta.Equal(para_.zeta) {
+		return errors.New("parameters are not the nothing-up-my-sleeve ones")
+	}
+	return nil
 }
 
 func UKG(para *Para) (*User, error) {
@@ -200,24 +234,6 @@ func DTest(ptr *PTResult, dsk *big.Int) error {
 	}
 }
 
-func getRandomG1() *bls12381.G1Affine {
-	order := bls12381.ID.ScalarField()
-	s1, err := rand.Int(rand.Reader, order)
-	if err != nil {
-		panic(err)
-	}
-	return new(bls12381.G1Affine).ScalarMultiplicationBase(s1)
-}
-
-func getRandomG2() *bls12381.G2Affine {
-	order := bls12381.ID.ScalarField()
-	s1, err := rand.Int(rand.Reader, order)
-	if err != nil {
-		panic(err)
-	}
-	return new(bls12381.G2Affine).ScalarMultiplicationBase(s1)
-}
-
 func getRandomGT() *bls12381.GT {
 	order := bls12381.ID.ScalarField()
 	s1, err := rand.Int(rand.Reader, order)
@@ -120,3 +120,17 @@ func BenchmarkDTest(b *testing.B) {
 		_ = DTest(ptr1, disc.dsk)
 	}
 }
+
+func TestSetup(t *testing.T) {
+	para, err := Setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyCRS(para); err != nil {
+		t.Error(err)
+	}
+	para.h = para.g
+	if VerifyCRS(para) == nil {
+		t.Error("tampered parameters verified")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+)
+
+// Fine-grained authorization of equality tests. Instead of its trapdoor, a
+// supervisor hands a tester one of these tokens:
+//
+//	UserToken:        tdU, unmasks TU of any testable ciphertext of the supervisor
+//	CiphertextToken:  ZC = U^tdC, unmasks TC of one ciphertext only
+//
+// and the test functions combine them into the four modes of the PKEET
+// literature: per-user (TestUser), per-ciphertext (TestCiphertexts),
+// user-to-ciphertext (TestUserCiphertext) and cross-user (TestCrossUser).
+// Every test compares MiMC(m). tdU and tdC are independent, so a user token
+// cannot make ciphertext tokens and a ciphertext token opens no user tag.
+
+// UserToken authorizes tests among all ciphertexts of one supervisor key
+type UserToken struct {
+	td SecretScalar
+	pk *twistededwards.PointAffine
+}
+
+// UserToken returns a per-user token. It holds its own copy of tdU, so it can
+// be destroyed without touching the trapdoor.
+func (td *Trapdoor) UserToken() *UserToken {
+	return &UserToken{NewSecretScalar(td.tdU.element()), td.pk.User}
+}
+
+// PublicKey returns the tpkU the token tests under
+func (tk *UserToken) PublicKey() *twistededwards.PointAffine {
+	return tk.pk
+}
+
+func (tk *UserToken) Destroy() {
+	tk.td.Destroy()
+}
+
+func (tk *UserToken) digest(ct *Ciphertext) (fr.Element, error) {
+	if err := checkJubjubPoint(ct.U); err != nil {
+		return fr.Element{}, err
+	}
+	return eqDigest(ct, jubjubMul(ct.U, tk.td.element()), eqTag)
+}
+
+// CiphertextToken authorizes tests on the single ciphertext with nonce point U
+type CiphertextToken struct {
+	U, Z *twistededwards.PointAffine
+}
+
+// CiphertextToken returns a token for ct alone
+func (td *Trapdoor) CiphertextToken(ct *Ciphertext) (*CiphertextToken, error) {
+	if err := checkJubjubPoint(ct.U); err != nil {
+		return nil, err
+	}
+	if ct.Tag == nil {
+		return nil, errors.New("ciphertext has no equality-test tag")
+	}
+	return &CiphertextToken{ct.U, jubjubMul(ct.U, td.tdC.element())}, nil
+}
+
+func (tk *CiphertextToken) digest(ct *Ciphertext) (fr.Element, error) {
+	if !tk.U.Equal(ct.U) {
+		return fr.Element{}, errors.New("token is for another ciphertext")
+	}
+	return eqDigest(ct, tk.Z, eqCtTag)
+}
+
+// eqToken recovers MiMC(m) from the ciphertexts it authorizes
+type eqToken interface {
+	digest(ct *Ciphertext) (fr.Element, error)
+}
+
+func testTokens(ct1 *Ciphertext, t1 eqToken, ct2 *Ciphertext, t2 eqToken) (bool, error) {
+	d1, err := t1.digest(ct1)
+	if err != nil {
+		return false, err
+	}
+	d2, err := t2.digest(ct2)
+	if err != nil {
+		return false, err
+	}
+	return d1.Equal(&d2), nil
+}
+
+// TestUser compares two ciphertexts of the supervisor behind tk
+func TestUser(ct1, ct2 *Ciphertext, tk *UserToken) (bool, error) {
+	return testTokens(ct1, tk, ct2, tk)
+}
+
+// TestCiphertexts compares two ciphertexts through their own tokens, which may
+// come from different supervisors
+func TestCiphertexts(ct1 *Ciphertext, t1 *CiphertextToken, ct2 *Ciphertext, t2 *CiphertextToken) (bool, error) {
+	return testTokens(ct1, t1, ct2, t2)
+}
+
+// TestUserCiphertext compares any ciphertext of the supervisor behind t1 with
+// the one ciphertext authorized by t2
+func TestUserCiphertext(ct1 *Ciphertext, t1 *UserToken, ct2 *Ciphertext, t2 *CiphertextToken) (bool, error) {
+	return testTokens(ct1, t1, ct2, t2)
+}
+
+// TestCrossUser compares ciphertexts of two different supervisors, each
+// through its per-user token. Ciphertexts of one supervisor go to TestUser.
+func TestCrossUser(ct1 *Ciphertext, t1 *UserToken, ct2 *Ciphertext, t2 *UserToken) (bool, error) {
+	if t1.pk.Equal(t2.pk) {
+		return false, errors.New("tokens are for the same supervisor")
+	}
+	return testTokens(ct1, t1, ct2, t2)
+}
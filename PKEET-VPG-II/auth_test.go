@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAuthorizationTokens(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	newKey := func() (*Key, *Trapdoor) {
+		sk, _ := RandSecretJubjub()
+		key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+		return key, key.Trapdoor(crs)
+	}
+	keyA, tdA := newKey()
+	keyB, tdB := newKey()
+	enc := func(key *Key, td *Trapdoor, m *twistededwards.PointAffine) *Ciphertext {
+		v, _ := randJubjubScalar()
+		ct, err := EncTest(crs, key.pk, td.PublicKey(), 1, m, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ct
+	}
+	x1, _ := randJubjubScalar()
+	x2, _ := randJubjubScalar()
+	m1, m2 := jubjubMul(crs.gj, x1), jubjubMul(crs.gj, x2)
+	a1, a1_, a2 := enc(keyA, tdA, m1), enc(keyA, tdA, m1), enc(keyA, tdA, m2)
+	b1, b2 := enc(keyB, tdB, m1), enc(keyB, tdB, m2)
+
+	check := func(want bool) func(bool, error) {
+		return func(eq bool, err error) {
+			assert.Nil(t, err)
+			assert.Equal(t, want, eq)
+		}
+	}
+
+	// per-user
+	uA, uB := tdA.UserToken(), tdB.UserToken()
+	assert.True(t, uA.PublicKey().Equal(tdA.PublicKey().User))
+	check(true)(TestUser(a1, a1_, uA))
+	check(false)(TestUser(a1, a2, uA))
+	check(false)(TestUser(a1, b1, uA))
+
+	// per-ciphertext
+	tA1, _ := tdA.CiphertextToken(a1)
+	tA2, _ := tdA.CiphertextToken(a2)
+	tB1, _ := tdB.CiphertextToken(b1)
+	check(true)(TestCiphertexts(a1, tA1, b1, tB1))
+	check(false)(TestCiphertexts(a2, tA2, b1, tB1))
+	_, err := TestCiphertexts(a1_, tA1, b1, tB1)
+	assert.NotNil(t, err)
+
+	// user-to-ciphertext
+	check(true)(TestUserCiphertext(a1_, uA, b1, tB1))
+	check(false)(TestUserCiphertext(a2, uA, b1, tB1))
+	_, err = TestUserCiphertext(a1, uA, b2, tB1)
+	assert.NotNil(t, err)
+
+	// cross-user
+	check(true)(TestCrossUser(a2, uA, b2, uB))
+	check(false)(TestCrossUser(a1, uA, b2, uB))
+
+	check(false)(TestUser(b1, b2, uA))
+	_, err = TestCrossUser(a1, uA, a1_, tdA.UserToken())
+	assert.NotNil(t, err)
+
+	// a token from one scope fails in another: the user key cannot stand in
+	// for a ciphertext token, and a ciphertext token opens no user tag
+	fake := &CiphertextToken{a1.U, jubjubMul(a1.U, uA.td.element())}
+	check(false)(TestCiphertexts(a1, fake, b1, tB1))
+	check(false)(TestUserCiphertext(a1_, uA, a1, fake))
+	d, err := eqDigest(a1, tA1.Z, eqTag)
+	assert.Nil(t, err)
+	d_, _ := uA.digest(a1)
+	assert.False(t, d.Equal(&d_))
+	assert.False(t, jubjubMul(crs.gj, uA.td.element()).Equal(tdA.PublicKey().Ct))
+
+	// tokens are scoped: a user token does not outlive Destroy, and the
+	// trapdoor survives it
+	uA.Destroy()
+	check(false)(TestUser(a1, a1_, uA))
+	check(true)(Test(a1, a1_, tdA))
+
+	v, _ := randJubjubScalar()
+	plain, _ := Enc(crs, keyA.pk, 1, m1, v)
+	_, err = tdA.CiphertextToken(plain)
+	assert.NotNil(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"math/big"
 )
@@ -32,11 +33,11 @@ type CGProof struct {
 }
 
 type XP struct {
-	x, rp *big.Int
+	x, rp *fr.Element
 }
 
 type XQ struct {
-	x, rq *big.Int
+	x, rq *fr.Element
 }
 
 func NewCGCRS(bc, bx, bf, tau int, Gp, Hp *twistededwards.PointAffine, Gq, Hq *bls12381.G1Affine) *CGCRS {
@@ -54,31 +55,52 @@ func NewCGCRS(bc, bx, bf, tau int, Gp, Hp *twistededwards.PointAffine, Gq, Hq *b
 
 // GenXP cross group DL proof
 func (cg *CGCRS) GenXP(xp *XP, xq *XQ) ([]*CGProof, error) {
-	if xp.x.Cmp(xq.x) != 0 {
+	if !xp.x.Equal(xq.x) {
 		return nil, fmt.Errorf("xp.x does not match xq.x")
 	}
+	// zx = k + c*x is computed on 256-bit limbs, and c must fit in one limb
+	if cg.bc > 64 || cg.bc+cg.bx+cg.bf > 254 {
+		return nil, fmt.Errorf("unsupported hyperparameters")
+	}
+	x := xp.x.Bits()
+	rp := xp.rp.Bits()
+	defer wipeLimbs(&x)
+	defer wipeLimbs(&rp)
+	if ctLess(rp, jubjubOrder) == 0 {
+		return nil, fmt.Errorf("xp.rp is not reduced modulo the Jubjub order")
+	}
+
 	var cgps []*CGProof
-	minZ := new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(cg.bc+cg.bx)), nil)
-	maxK := new(big.Int).Exp(big.NewInt(2), big.NewInt(int64(cg.bc+cg.bx+cg.bf)), nil)
-	maxK = new(big.Int).Sub(maxK, big.NewInt(1))
-	curve := twistededwards.GetEdwardsCurve()
-	modP := &curve.Order
-	modQ := bls12381.ID.ScalarField()
+	comP := new(twistededwards.PointAffine).Add(jubjubMul(cg.Gp, xp.x), jubjubMul(cg.Hp, xp.rp))
+	comQ := new(bls12381.G1Affine).Add(g1Mul(cg.Gq, xq.x), g1Mul(cg.Hq, xq.rq))
 
 	// retry counter
 	count := 0
+	// ephemeral nonces, wiped once the proof is done
+	var k, tpl [4]uint64
+	var tq fr.Element
+	defer wipeLimbs(&k)
+	defer wipeLimbs(&tpl)
+	defer wipeElement(&tq)
 	for i := 0; i < cg.tau; i++ {
-		k, err := rand.Int(rand.Reader, maxK)
+		var err error
+		k, err = randLimbs(cg.bc + cg.bx + cg.bf)
 		if err != nil {
 			return nil, fmt.Errorf("fail to generate random number: %w", err)
 		}
-		tp, _ := rand.Int(rand.Reader, modP)
-		tq, _ := rand.Int(rand.Reader, modQ)
-		KP := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(cg.Gp, k), new(twistededwards.PointAffine).ScalarMultiplication(cg.Hp, tp))
-		KQ := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(cg.Gq, k), new(bls12381.G1Affine).ScalarMultiplication(cg.Hq, tq))
-
-		comP := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(cg.Gp, xp.x), new(twistededwards.PointAffine).ScalarMultiplication(cg.Hp, xp.rp))
-		comQ := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(cg.Gq, xq.x), new(bls12381.G1Affine).ScalarMultiplication(cg.Hq, xq.rq))
+		tp, err := randJubjubScalar()
+		if err != nil {
+			return nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
+		tpl = tp.Bits()
+		wipeElement(tp)
+		if _, err = tq.SetRandom(); err != nil {
+			return nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
+		kq := frFromLimbs(k)
+		KP := new(twistededwards.PointAffine).Add(jubjubMulLimbs(cg.Gp, k), jubjubMulLimbs(cg.Hp, tpl))
+		KQ := new(bls12381.G1Affine).Add(g1Mul(cg.Gq, kq), g1Mul(cg.Hq, &tq))
+		wipeElement(kq)
 
 		arr := append(comP.Marshal(), comQ.Marshal()...)
 		arr = append(arr, KP.Marshal()...)
@@ -90,10 +112,16 @@ func (cg *CGCRS) GenXP(xp *XP, xq *XQ) ([]*CGProof, error) {
 		c := sha256.Sum256(arr)
 
 		// zx, zp, zq
-		var zx, zp, zq big.Int
 		cint := new(big.Int).SetBytes(c[:cg.bc/8])
-		zx.Add(k, new(big.Int).Mul(cint, xp.x))
-		if zx.Cmp(minZ) == -1 || zx.Cmp(maxK) == 1 {
+		cu := cint.Uint64()
+
+		// zx is an integer, so the range check runs on the limbs without branching
+		// on their value. Only the accept/reject outcome is revealed.
+		zx, carry := ctMulAddSmall(k, x, cu)
+		inRange := ((carry | -carry) >> 63) ^ 1
+		inRange &= ctHighZero(zx, uint(cg.bc+cg.bx)) ^ 1
+		inRange &= ctHighZero(zx, uint(cg.bc+cg.bx+cg.bf))
+		if inRange == 0 {
 			if count > 10 {
 				return nil, fmt.Errorf("zx out of range")
 			} else {
@@ -102,16 +130,15 @@ func (cg *CGCRS) GenXP(xp *XP, xq *XQ) ([]*CGProof, error) {
 				continue
 			}
 		}
-		zp.Add(tp, new(big.Int).Mul(cint, xp.rp))
-		zp.Mod(&zp, modP)
-		zq.Add(tq, new(big.Int).Mul(cint, xq.rq))
-		zq.Mod(&zq, modQ)
+		zp := ctAddMod(tpl, ctMulSmallMod(rp, cu, jubjubOrder), jubjubOrder)
+		var cf fr.Element
+		cf.SetUint64(cu)
 
 		cgp := CGProof{
 			c:    cint,
-			zx:   &zx,
-			zp:   &zp,
-			zq:   &zq,
+			zx:   limbsToBig(zx),
+			zp:   limbsToBig(zp),
+			zq:   frResponse(&tq, &cf, xq.rq),
 			comP: comP,
 			comQ: comQ,
 		}
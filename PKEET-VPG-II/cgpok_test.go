@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"errors"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"math/big"
 	"testing"
@@ -24,12 +25,12 @@ func TestCG(t *testing.T) {
 	rp, _ := rand.Int(rand.Reader, modP)
 	rq, _ := rand.Int(rand.Reader, modQ)
 	xp := XP{
-		x:  x,
-		rp: rp,
+		x:  frOf(x),
+		rp: frOf(rp),
 	}
 	xq := XQ{
-		x:  x,
-		rq: rq,
+		x:  frOf(x),
+		rq: frOf(rq),
 	}
 	cgps, err := cg.GenXP(&xp, &xq)
 	if err != nil {
@@ -85,6 +86,10 @@ func TestSplit(t *testing.T) {
 	}
 }
 
+func frOf(n *big.Int) *fr.Element {
+	return new(fr.Element).SetBigInt(n)
+}
+
 func BenchmarkCGGen(b *testing.B) {
 	curve := twistededwards.GetEdwardsCurve()
 	modP := &curve.Order
@@ -112,10 +117,10 @@ func BenchmarkCGGen(b *testing.B) {
 	highRP := new(big.Int).Rsh(rp, uint(bx))
 	highRQ := new(big.Int).Rsh(rq, uint(bx))
 
-	lowXp := &XP{lowX, lowRP}
-	lowXq := &XQ{lowX, lowRQ}
-	highXp := &XP{highX, highRP}
-	highXq := &XQ{highX, highRQ}
+	lowXp := &XP{frOf(lowX), frOf(lowRP)}
+	lowXq := &XQ{frOf(lowX), frOf(lowRQ)}
+	highXp := &XP{frOf(highX), frOf(highRP)}
+	highXq := &XQ{frOf(highX), frOf(highRQ)}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -151,10 +156,10 @@ func BenchmarkCGVer(b *testing.B) {
 	highRP := new(big.Int).Rsh(rp, uint(bx))
 	highRQ := new(big.Int).Rsh(rq, uint(bx))
 
-	lowXp := &XP{lowX, lowRP}
-	lowXq := &XQ{lowX, lowRQ}
-	highXp := &XP{highX, highRP}
-	highXq := &XQ{highX, highRQ}
+	lowXp := &XP{frOf(lowX), frOf(lowRP)}
+	lowXq := &XQ{frOf(lowX), frOf(lowRQ)}
+	highXp := &XP{frOf(highX), frOf(highRP)}
+	highXq := &XQ{frOf(highX), frOf(highRQ)}
 
 	comP := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(cg.Gp, x), new(twistededwards.PointAffine).ScalarMultiplication(cg.Hp, rp))
 	comQ := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(cg.Gq, x), new(bls12381.G1Affine).ScalarMultiplication(cg.Hq, rq))
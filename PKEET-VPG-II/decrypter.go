@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Decrypter performs the only step of Dec that needs the supervisor key,
+// Y = U^sk, so that the key can stay in another process
+type Decrypter interface {
+	PublicKey() *twistededwards.PointAffine
+	SharedPoint(U *twistededwards.PointAffine) (*twistededwards.PointAffine, error)
+}
+
+func (key *Key) PublicKey() *twistededwards.PointAffine {
+	return key.pk
+}
+
+// SharedPoint returns U^sk. U must be in the prime-order subgroup, so the
+// answer never leaks sk modulo the cofactor.
+func (key *Key) SharedPoint(U *twistededwards.PointAffine) (*twistededwards.PointAffine, error) {
+	if err := checkJubjubPoint(U); err != nil {
+		return nil, err
+	}
+	return jubjubMul(U, key.sk.element()), nil
+}
+
+// checkJubjubPoint rejects points off the curve or outside the prime-order subgroup
+func checkJubjubPoint(P *twistededwards.PointAffine) error {
+	if P == nil || !P.IsOnCurve() {
+		return errors.New("point is not on the curve")
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	if !new(twistededwards.PointAffine).ScalarMultiplication(P, &curve.Order).IsZero() {
+		return errors.New("point is not in the prime-order subgroup")
+	}
+	return nil
+}
+
+// Wire format between RemoteDecrypter and ServeDecrypter. A request is an op
+// byte followed by a compressed point U for opSharedPoint and opSharedPointProof.
+// A response is a status byte, a 2-byte big-endian length and the payload: a
+// compressed point, followed by a DLEQ proof for opSharedPointProof, on
+// success, and an error message otherwise.
+const (
+	opPublicKey        byte = 1
+	opSharedPoint      byte = 2
+	opSharedPointProof byte = 3
+
+	statusOK  byte = 0
+	statusErr byte = 1
+
+	pointSize = 32
+)
+
+// ServeDecrypter answers decryption requests on l with d until l is closed.
+// It is meant to run inside the process that holds the supervisor key.
+func ServeDecrypter(l net.Listener, d Decrypter) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveDecrypterConn(conn, d)
+	}
+}
+
+func serveDecrypterConn(conn net.Conn, d Decrypter) {
+	defer conn.Close()
+	for {
+		var op [1]byte
+		if _, err := io.ReadFull(conn, op[:]); err != nil {
+			return
+		}
+		var res []byte
+		var err error
+		switch op[0] {
+		case opPublicKey:
+			res = d.PublicKey().Marshal()
+		case opSharedPoint, opSharedPointProof:
+			var buf [pointSize]byte
+			if _, err = io.ReadFull(conn, buf[:]); err != nil {
+				return
+			}
+			U := new(twistededwards.PointAffine)
+			if err = U.Unmarshal(buf[:]); err != nil {
+				break
+			}
+			if op[0] == opSharedPoint {
+				var Y *twistededwards.PointAffine
+				if Y, err = d.SharedPoint(U); err == nil {
+					res = Y.Marshal()
+				}
+			} else if pd, ok := d.(ProvingDecrypter); ok {
+				var Y *twistededwards.PointAffine
+				var pf *DLEQProof
+				if Y, pf, err = pd.SharedPointWithProof(U); err == nil {
+					res = append(Y.Marshal(), pf.marshal()...)
+				}
+			} else {
+				err = errors.New("decrypter cannot prove decryption")
+			}
+		default:
+			err = fmt.Errorf("unknown op %d", op[0])
+		}
+		if writeDecrypterResponse(conn, res, err) != nil {
+			return
+		}
+	}
+}
+
+func writeDecrypterResponse(w io.Writer, payload []byte, err error) error {
+	status := statusOK
+	if err != nil {
+		status, payload = statusErr, []byte(err.Error())
+	}
+	if len(payload) > 0xffff {
+		payload = payload[:0xffff]
+	}
+	msg := make([]byte, 3, 3+len(payload))
+	msg[0] = status
+	binary.BigEndian.PutUint16(msg[1:3], uint16(len(payload)))
+	_, err = w.Write(append(msg, payload...))
+	return err
+}
+
+// RemoteDecrypter is a Decrypter backed by ServeDecrypter over a Unix socket
+type RemoteDecrypter struct {
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	pk   *twistededwards.PointAffine
+}
+
+// DialDecrypter connects to the decrypter listening on the Unix socket at path
+// and fetches its public key
+func DialDecrypter(path string) (*RemoteDecrypter, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	rd := &RemoteDecrypter{Timeout: 30 * time.Second, conn: conn}
+	body, err := rd.call(opPublicKey, nil)
+	if err == nil {
+		rd.pk, err = parseRemotePoint(body)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *RemoteDecrypter) PublicKey() *twistededwards.PointAffine {
+	return rd.pk
+}
+
+// SharedPoint asks the remote process for U^sk and checks the answer is a
+// subgroup point
+func (rd *RemoteDecrypter) SharedPoint(U *twistededwards.PointAffine) (*twistededwards.PointAffine, error) {
+	if err := checkJubjubPoint(U); err != nil {
+		return nil, err
+	}
+	body, err := rd.call(opSharedPoint, U.Marshal())
+	if err != nil {
+		return nil, err
+	}
+	return parseRemotePoint(body)
+}
+
+// SharedPointWithProof asks the remote process for U^sk together with a DLEQ
+// proof. The proof is not checked here, VerifyDecryption does it.
+func (rd *RemoteDecrypter) SharedPointWithProof(U *twistededwards.PointAffine) (*twistededwards.PointAffine, *DLEQProof, error) {
+	if err := checkJubjubPoint(U); err != nil {
+		return nil, nil, err
+	}
+	body, err := rd.call(opSharedPointProof, U.Marshal())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(body) < pointSize {
+		return nil, nil, errors.New("remote decrypter: short response")
+	}
+	Y, err := parseRemotePoint(body[:pointSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	pf, err := unmarshalDLEQ(body[pointSize:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	return Y, pf, nil
+}
+
+func (rd *RemoteDecrypter) Close() error {
+	return rd.conn.Close()
+}
+
+func (rd *RemoteDecrypter) call(op byte, payload []byte) ([]byte, error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if rd.Timeout > 0 {
+		if err := rd.conn.SetDeadline(time.Now().Add(rd.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := rd.conn.Write(append([]byte{op}, payload...)); err != nil {
+		return nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	var hdr [3]byte
+	if _, err := io.ReadFull(rd.conn, hdr[:]); err != nil {
+		return nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[1:3]))
+	if _, err := io.ReadFull(rd.conn, body); err != nil {
+		return nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	if hdr[0] != statusOK {
+		return nil, errors.New("remote decrypter: " + string(body))
+	}
+	return body, nil
+}
+
+// parseRemotePoint decodes a point sent by the remote process and checks it is
+// in the prime-order subgroup
+func parseRemotePoint(body []byte) (*twistededwards.PointAffine, error) {
+	P := new(twistededwards.PointAffine)
+	if err := P.Unmarshal(body); err != nil {
+		return nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	if err := checkJubjubPoint(P); err != nil {
+		return nil, fmt.Errorf("remote decrypter: %w", err)
+	}
+	return P, nil
+}
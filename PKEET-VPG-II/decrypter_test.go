@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// startDecrypter runs the key behind a Unix socket in this process, standing in
+// for the separate signing process
+func startDecrypter(t *testing.T, d Decrypter) string {
+	dir, err := os.MkdirTemp("", "dec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- ServeDecrypter(l, d) }()
+	t.Cleanup(func() {
+		l.Close()
+		assert.Nil(t, <-done)
+	})
+	return path
+}
+
+func TestRemoteDecrypter(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+
+	rd, err := DialDecrypter(startDecrypter(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	assert.True(t, key.pk.Equal(rd.PublicKey()))
+
+	for i := 0; i < 3; i++ {
+		x, _ := randJubjubScalar()
+		v, _ := randJubjubScalar()
+		m := jubjubMul(crs.gj, x)
+		ct, err := Enc(crs, rd.PublicKey(), 0, m, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		local, err := Dec(crs, ct, key)
+		assert.Nil(t, err)
+		remote, err := Dec(crs, ct, rd)
+		assert.Nil(t, err)
+		assert.Equal(t, m, local)
+		assert.Equal(t, m, remote)
+	}
+}
+
+func TestDecrypterRejectsSmallOrderPoints(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(&curve.Base, sk.element())}
+
+	// (0, -1) has order 2
+	var T twistededwards.PointAffine
+	T.Y.SetOne()
+	T.Y.Neg(&T.Y)
+	assert.True(t, T.IsOnCurve())
+	_, err := key.SharedPoint(&T)
+	assert.NotNil(t, err)
+
+	// the server rejects it as well when a client skips the local check
+	path := startDecrypter(t, key)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rd := &RemoteDecrypter{conn: conn}
+	_, err = rd.call(opSharedPoint, T.Marshal())
+	assert.NotNil(t, err)
+
+	// the connection survives a rejected request
+	body, err := rd.call(opSharedPoint, curve.Base.Marshal())
+	assert.Nil(t, err)
+	Y, err := parseRemotePoint(body)
+	assert.Nil(t, err)
+	assert.True(t, Y.Equal(key.pk))
+}
+
+func TestRemoteDecrypterClosed(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(&curve.Base, sk.element())}
+
+	rd, err := DialDecrypter(startDecrypter(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.Close()
+	_, err = rd.SharedPoint(&curve.Base)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+// Pedersen's joint-Feldman DKG over Jubjub. Every party i deals a random
+// polynomial f_i of degree t-1: it broadcasts A_ik = gj^{a_ik} and sends
+// s_ij = f_i(j) privately to party j, who checks gj^{s_ij} = prod_k A_ik^{j^k}
+// and broadcasts a complaint otherwise. A dealer answers each complaint by
+// broadcasting the disputed share; dealers that stay silent or answer with a
+// bad share are disqualified. Over the qualified set QUAL,
+// sk_j = sum_i s_ij, pk = prod_i A_i0 and sk = sum_i f_i(0) is never formed.
+// The result is a ThresholdKey and KeyShare as produced by SplitKey.
+//
+// Private shares travel as DKGShare messages. The bus must keep them
+// confidential and authenticate every sender, and broadcasts must reach
+// everybody with the same content.
+
+// DKGDeal is the broadcast commitment A_i0..A_i(t-1) of dealer From
+type DKGDeal struct {
+	From        uint32
+	Commitments []*twistededwards.PointAffine
+}
+
+// DKGShare is the private share f_From(To)
+type DKGShare struct {
+	From, To uint32
+	Share    SecretScalar
+}
+
+// DKGComplaint is broadcast by From when the share of Against is missing or
+// does not match its commitments
+type DKGComplaint struct {
+	From, Against uint32
+}
+
+// DKGReveal is the public answer of dealer From to a complaint of To
+type DKGReveal struct {
+	From, To uint32
+	Share    *big.Int
+}
+
+// DKGMessage is one message on the bus. To == 0 broadcasts it.
+type DKGMessage struct {
+	From, To uint32
+	Body     interface{}
+}
+
+// DKGBus delivers the messages of one round. Exchange blocks until all parties
+// have sent their messages for the round and returns those for party from,
+// broadcasts included.
+type DKGBus interface {
+	Exchange(from uint32, msgs []DKGMessage) ([]DKGMessage, error)
+}
+
+// RunDKG runs party index of a t-of-n DKG over bus and returns the joint key
+// and the share of this party
+func RunDKG(bus DKGBus, index uint32, t, n int) (*ThresholdKey, *KeyShare, error) {
+	p, err := newDKGParty(index, t, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer p.destroy()
+
+	in, err := bus.Exchange(index, p.deal())
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err = bus.Exchange(index, p.verify(in))
+	if err != nil {
+		return nil, nil, err
+	}
+	in, err = bus.Exchange(index, p.answer(in))
+	if err != nil {
+		return nil, nil, err
+	}
+	p.resolve(in)
+	return p.finish()
+}
+
+type dkgParty struct {
+	index  uint32
+	t, n   int
+	coeffs [][4]uint64
+
+	commits    map[uint32][]*twistededwards.PointAffine
+	shares     map[uint32]*fr.Element
+	complaints map[uint32][]uint32 // dealer -> complainers
+	disq       map[uint32]bool
+}
+
+func newDKGParty(index uint32, t, n int) (*dkgParty, error) {
+	if t < 1 || t > n || n >= 1<<16 || index == 0 || int(index) > n {
+		return nil, fmt.Errorf("invalid DKG party %d of %d-of-%d", index, t, n)
+	}
+	p := &dkgParty{
+		index:      index,
+		t:          t,
+		n:          n,
+		coeffs:     make([][4]uint64, t),
+		commits:    make(map[uint32][]*twistededwards.PointAffine),
+		shares:     make(map[uint32]*fr.Element),
+		complaints: make(map[uint32][]uint32),
+		disq:       make(map[uint32]bool),
+	}
+	for i := range p.coeffs {
+		a, err := randJubjubScalar()
+		if err != nil {
+			p.destroy()
+			return nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
+		p.coeffs[i] = a.Bits()
+		wipeElement(a)
+	}
+	return p, nil
+}
+
+func (p *dkgParty) destroy() {
+	for i := range p.coeffs {
+		wipeLimbs(&p.coeffs[i])
+	}
+	for _, s := range p.shares {
+		wipeElement(s)
+	}
+}
+
+// deal commits to f_i and sends f_i(j) to every j, including itself
+func (p *dkgParty) deal() []DKGMessage {
+	curve := twistededwards.GetEdwardsCurve()
+	commits := make([]*twistededwards.PointAffine, p.t)
+	for k := range p.coeffs {
+		commits[k] = jubjubMulLimbs(&curve.Base, p.coeffs[k])
+	}
+	msgs := []DKGMessage{{p.index, 0, &DKGDeal{p.index, commits}}}
+	for j := 1; j <= p.n; j++ {
+		s := evalPoly(p.coeffs, uint64(j))
+		share := SecretScalar{frFromLimbs(s)}
+		wipeLimbs(&s)
+		msgs = append(msgs, DKGMessage{p.index, uint32(j), &DKGShare{p.index, uint32(j), share}})
+	}
+	return msgs
+}
+
+// verify records deals and shares and complains about bad ones
+func (p *dkgParty) verify(in []DKGMessage) []DKGMessage {
+	for _, msg := range in {
+		switch body := msg.Body.(type) {
+		case *DKGDeal:
+			if body.From == msg.From && msg.To == 0 && p.validDeal(body) {
+				p.commits[msg.From] = body.Commitments
+			}
+		case *DKGShare:
+			if body.From == msg.From && body.To == p.index && msg.To == p.index {
+				if old := p.shares[msg.From]; old != nil {
+					wipeElement(old)
+				}
+				p.shares[msg.From] = new(fr.Element).Set(body.Share.element())
+				body.Share.Destroy()
+			}
+		}
+	}
+	var out []DKGMessage
+	for i := 1; i <= p.n; i++ {
+		dealer := uint32(i)
+		if p.commits[dealer] == nil {
+			// a missing deal is seen by everybody, no complaint needed
+			p.disq[dealer] = true
+			continue
+		}
+		if s := p.shares[dealer]; s == nil || !p.checkShare(dealer, p.index, s) {
+			out = append(out, DKGMessage{p.index, 0, &DKGComplaint{p.index, dealer}})
+		}
+	}
+	return out
+}
+
+// answer reveals the shares complained about to this party
+func (p *dkgParty) answer(in []DKGMessage) []DKGMessage {
+	var out []DKGMessage
+	for _, msg := range in {
+		c, ok := msg.Body.(*DKGComplaint)
+		if !ok || c.From != msg.From || msg.To != 0 || c.From == 0 || int(c.From) > p.n {
+			continue
+		}
+		p.complaints[c.Against] = append(p.complaints[c.Against], c.From)
+		if c.Against == p.index {
+			s := evalPoly(p.coeffs, uint64(c.From))
+			out = append(out, DKGMessage{p.index, 0, &DKGReveal{p.index, c.From, limbsToBig(s)}})
+			wipeLimbs(&s)
+		}
+	}
+	return out
+}
+
+// resolve disqualifies dealers that did not answer every complaint with a share
+// matching their commitments
+func (p *dkgParty) resolve(in []DKGMessage) {
+	reveals := make(map[[2]uint32]*big.Int)
+	for _, msg := range in {
+		r, ok := msg.Body.(*DKGReveal)
+		if ok && r.From == msg.From && msg.To == 0 && r.Share != nil {
+			reveals[[2]uint32{r.From, r.To}] = r.Share
+		}
+	}
+	for dealer, froms := range p.complaints {
+		if p.disq[dealer] {
+			continue
+		}
+		for _, j := range froms {
+			r := reveals[[2]uint32{dealer, j}]
+			if r == nil || r.Sign() < 0 || r.Cmp(limbsToBig(jubjubOrder)) >= 0 {
+				p.disq[dealer] = true
+				break
+			}
+			s := frFromLimbs(bigToLimbs(r))
+			if !p.checkShare(dealer, j, s) {
+				p.disq[dealer] = true
+				break
+			}
+			if j == p.index {
+				if old := p.shares[dealer]; old != nil {
+					wipeElement(old)
+				}
+				p.shares[dealer] = s
+			}
+		}
+	}
+}
+
+// finish sums the shares of QUAL and derives pk and every vk_j
+func (p *dkgParty) finish() (*ThresholdKey, *KeyShare, error) {
+	var qual []uint32
+	for i := 1; i <= p.n; i++ {
+		if !p.disq[uint32(i)] {
+			qual = append(qual, uint32(i))
+		}
+	}
+	if len(qual) == 0 {
+		return nil, nil, errors.New("dkg: every dealer was disqualified")
+	}
+
+	pk := new(twistededwards.PointAffine)
+	pk.X.SetZero()
+	pk.Y.SetOne()
+	var sk [4]uint64
+	defer wipeLimbs(&sk)
+	for _, i := range qual {
+		pk.Add(pk, p.commits[i][0])
+		s := p.shares[i].Bits()
+		sk = ctAddMod(sk, s, jubjubOrder)
+		wipeLimbs(&s)
+	}
+
+	tk := &ThresholdKey{T: p.t, N: p.n, pk: pk, vks: make([]*twistededwards.PointAffine, p.n)}
+	for j := 1; j <= p.n; j++ {
+		vk := new(twistededwards.PointAffine)
+		vk.X.SetZero()
+		vk.Y.SetOne()
+		for _, i := range qual {
+			vk.Add(vk, evalCommitments(p.commits[i], uint32(j)))
+		}
+		tk.vks[j-1] = vk
+	}
+	ks := &KeyShare{p.index, SecretScalar{frFromLimbs(sk)}, tk.vks[p.index-1]}
+	curve := twistededwards.GetEdwardsCurve()
+	if !jubjubMul(&curve.Base, ks.sk.element()).Equal(ks.vk) {
+		ks.Destroy()
+		return nil, nil, errors.New("dkg: share does not match the qualified commitments")
+	}
+	return tk, ks, nil
+}
+
+func (p *dkgParty) validDeal(d *DKGDeal) bool {
+	if len(d.Commitments) != p.t {
+		return false
+	}
+	for _, A := range d.Commitments {
+		if checkJubjubPoint(A) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkShare checks that s is reduced and gj^s = prod_k A_k^{j^k} for the
+// commitments of dealer
+func (p *dkgParty) checkShare(dealer, j uint32, s *fr.Element) bool {
+	l := s.Bits()
+	defer wipeLimbs(&l)
+	if ctLess(l, jubjubOrder) == 0 {
+		return false
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	return jubjubMul(&curve.Base, s).Equal(evalCommitments(p.commits[dealer], j))
+}
+
+// evalCommitments returns gj^{f(j)} from the commitments to the coefficients of f
+func evalCommitments(commits []*twistededwards.PointAffine, j uint32) *twistededwards.PointAffine {
+	res := new(twistededwards.PointAffine)
+	res.X.SetZero()
+	res.Y.SetOne()
+	J := big.NewInt(int64(j))
+	for k := len(commits) - 1; k >= 0; k-- {
+		res.ScalarMultiplication(res, J)
+		res.Add(res, commits[k])
+	}
+	return res
+}
+
+// LocalBus is an in-memory DKGBus for n parties running in one process
+type LocalBus struct {
+	n int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	round   int
+	sent    int
+	pending map[uint32][]DKGMessage
+	inbox   map[uint32][]DKGMessage
+}
+
+func NewLocalBus(n int) *LocalBus {
+	b := &LocalBus{n: n, pending: make(map[uint32][]DKGMessage)}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Exchange queues msgs and waits for the other parties of the round. The
+// sender of each message is forced to from.
+func (b *LocalBus) Exchange(from uint32, msgs []DKGMessage) ([]DKGMessage, error) {
+	if from == 0 || int(from) > b.n {
+		return nil, fmt.Errorf("dkg: unknown party %d", from)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range msgs {
+		msg.From = from
+		if msg.To == 0 {
+			for j := 1; j <= b.n; j++ {
+				b.pending[uint32(j)] = append(b.pending[uint32(j)], msg)
+			}
+		} else if int(msg.To) <= b.n {
+			b.pending[msg.To] = append(b.pending[msg.To], msg)
+		}
+	}
+	round := b.round
+	b.sent++
+	if b.sent == b.n {
+		b.inbox, b.pending = b.pending, make(map[uint32][]DKGMessage)
+		b.sent = 0
+		b.round++
+		b.cond.Broadcast()
+	}
+	for b.round == round {
+		b.cond.Wait()
+	}
+	in := b.inbox[from]
+	sort.SliceStable(in, func(i, j int) bool { return in[i].From < in[j].From })
+	return in, nil
+}
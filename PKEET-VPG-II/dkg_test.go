@@ -0,0 +1,160 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+// tamperBus lets a test rewrite the outgoing messages of the parties
+type tamperBus struct {
+	DKGBus
+	tamper func(msg *DKGMessage)
+}
+
+func (b *tamperBus) Exchange(from uint32, msgs []DKGMessage) ([]DKGMessage, error) {
+	for i := range msgs {
+		msgs[i].From = from
+		b.tamper(&msgs[i])
+	}
+	return b.DKGBus.Exchange(from, msgs)
+}
+
+type dkgResult struct {
+	tk  *ThresholdKey
+	ks  *KeyShare
+	err error
+}
+
+func runLocalDKG(bus DKGBus, t, n int) []dkgResult {
+	res := make([]dkgResult, n)
+	var wg sync.WaitGroup
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tk, ks, err := RunDKG(bus, uint32(i), t, n)
+			res[i-1] = dkgResult{tk, ks, err}
+		}(i)
+	}
+	wg.Wait()
+	return res
+}
+
+// checkDKG checks that every party agrees on the key and that it decrypts
+// through threshold decryption
+func checkDKG(t *testing.T, res []dkgResult) *ThresholdKey {
+	for _, r := range res {
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+	}
+	tk := res[0].tk
+	assert.Nil(t, CheckThresholdKey(tk))
+	for _, r := range res {
+		assert.True(t, tk.pk.Equal(r.tk.pk))
+		assert.Equal(t, tk.vks, r.tk.vks)
+		assert.True(t, r.ks.vk.Equal(tk.VerificationKey(r.ks.Index)))
+	}
+
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	x, _ := randJubjubScalar()
+	v, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	ct, err := Enc(crs, tk.PublicKey(), 0, m, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []*PartialDecryption
+	for _, r := range res[len(res)-tk.T:] {
+		pd, err := r.ks.PartialDecrypt(ct.U)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, pd)
+	}
+	m_, invalid, err := Combine(crs, tk, ct, parts)
+	assert.Nil(t, err)
+	assert.Empty(t, invalid)
+	assert.Equal(t, m, m_)
+	return tk
+}
+
+func TestDKG(t *testing.T) {
+	for _, tn := range [][2]int{{1, 1}, {2, 3}, {3, 5}} {
+		checkDKG(t, runLocalDKG(NewLocalBus(tn[1]), tn[0], tn[1]))
+	}
+}
+
+// dealBus records the deals going through the bus
+type dealBus struct {
+	mu    sync.Mutex
+	deals map[uint32]*DKGDeal
+}
+
+func (b *dealBus) record(msg *DKGMessage) {
+	if d, ok := msg.Body.(*DKGDeal); ok {
+		b.mu.Lock()
+		b.deals[d.From] = d
+		b.mu.Unlock()
+	}
+}
+
+// sumDeals returns the pk expected from the given qualified dealers
+func (b *dealBus) sumDeals(qual ...uint32) *twistededwards.PointAffine {
+	pk := new(twistededwards.PointAffine)
+	pk.X.SetZero()
+	pk.Y.SetOne()
+	for _, i := range qual {
+		pk.Add(pk, b.deals[i].Commitments[0])
+	}
+	return pk
+}
+
+func TestDKGComplaints(t *testing.T) {
+	// a share corrupted in transit is answered by an honest dealer, who stays
+	// qualified
+	rec := &dealBus{deals: make(map[uint32]*DKGDeal)}
+	bus := &tamperBus{NewLocalBus(5), func(msg *DKGMessage) {
+		rec.record(msg)
+		if s, ok := msg.Body.(*DKGShare); ok && s.From == 2 && s.To == 4 {
+			s.Share.element().Add(s.Share.element(), new(fr.Element).SetOne())
+		}
+	}}
+	tk := checkDKG(t, runLocalDKG(bus, 3, 5))
+	assert.True(t, tk.pk.Equal(rec.sumDeals(1, 2, 3, 4, 5)))
+
+	// a dealer who sends a bad share and defends it with a bad reveal is
+	// disqualified, so is a dealer who stays silent
+	rec = &dealBus{deals: make(map[uint32]*DKGDeal)}
+	bus = &tamperBus{NewLocalBus(5), func(msg *DKGMessage) {
+		rec.record(msg)
+		switch body := msg.Body.(type) {
+		case *DKGDeal:
+			if body.From == 5 {
+				msg.Body = nil
+			}
+		case *DKGShare:
+			if body.From == 2 && body.To == 4 {
+				body.Share.element().Add(body.Share.element(), new(fr.Element).SetOne())
+			}
+		case *DKGReveal:
+			if body.From == 2 {
+				body.Share = new(big.Int).Add(body.Share, big.NewInt(1))
+			}
+		}
+	}}
+	tk = checkDKG(t, runLocalDKG(bus, 3, 5))
+	assert.True(t, tk.pk.Equal(rec.sumDeals(1, 3, 4)))
+}
+
+func TestDKGInvalidParty(t *testing.T) {
+	_, _, err := RunDKG(NewLocalBus(3), 0, 2, 3)
+	assert.NotNil(t, err)
+	_, _, err = RunDKG(NewLocalBus(3), 1, 4, 3)
+	assert.NotNil(t, err)
+}
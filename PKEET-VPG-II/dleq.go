@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"math/big"
+)
+
+// DLEQProof is a Chaum-Pedersen proof that log_g(G) = log_h(H) on Jubjub
+type DLEQProof struct {
+	c, z *big.Int
+}
+
+// DecProof shows that Y = U^sk for the sk behind pk, so that anyone can
+// recompute the W masks from Y and check the revealed m
+type DecProof struct {
+	Y *twistededwards.PointAffine
+	*DLEQProof
+}
+
+// ProvingDecrypter is a Decrypter that can also prove its answer
+type ProvingDecrypter interface {
+	Decrypter
+	SharedPointWithProof(U *twistededwards.PointAffine) (*twistededwards.PointAffine, *DLEQProof, error)
+}
+
+// SharedPointWithProof returns U^sk and a DLEQ proof against pk = gj^sk, with
+// gj the Jubjub base point as in every PKECRS
+func (key *Key) SharedPointWithProof(U *twistededwards.PointAffine) (*twistededwards.PointAffine, *DLEQProof, error) {
+	Y, err := key.SharedPoint(U)
+	if err != nil {
+		return nil, nil, err
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	pf, err := proveDLEQ(nil, &curve.Base, key.pk, U, Y, key.sk.element())
+	if err != nil {
+		return nil, nil, err
+	}
+	return Y, pf, nil
+}
+
+// DecryptWithProof opens ct and proves that the decryption is honest
+func DecryptWithProof(crs *PKECRS, ct *Ciphertext, d ProvingDecrypter) (*twistededwards.PointAffine, *DecProof, error) {
+	curve := twistededwards.GetEdwardsCurve()
+	if !crs.gj.Equal(&curve.Base) {
+		return nil, nil, errors.New("decryption proofs assume gj is the Jubjub base point")
+	}
+	Y, pf, err := d.SharedPointWithProof(ct.U)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := decWithY(crs, ct, Y)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, &DecProof{Y, pf}, nil
+}
+
+// VerifyDecryption checks that m is what ct decrypts to under the key behind pk
+func VerifyDecryption(crs *PKECRS, pk *twistededwards.PointAffine, ct *Ciphertext, m *twistededwards.PointAffine, proof *DecProof) error {
+	if proof == nil || proof.DLEQProof == nil {
+		return errors.New("missing decryption proof")
+	}
+	for _, P := range []*twistededwards.PointAffine{pk, ct.U, proof.Y} {
+		if err := checkJubjubPoint(P); err != nil {
+			return fmt.Errorf("decryption proof is invalid: %w", err)
+		}
+	}
+	if err := verifyDLEQ(nil, crs.gj, pk, ct.U, proof.Y, proof.DLEQProof); err != nil {
+		return err
+	}
+	m_, err := decWithY(crs, ct, proof.Y)
+	if err != nil {
+		return fmt.Errorf("decryption proof is invalid: %w", err)
+	}
+	if !m_.Equal(m) {
+		return errors.New("decryption proof is invalid, m mismatch")
+	}
+	return nil
+}
+
+// proveDLEQ proves log_g(G) = log_h(H) = x for x below the Jubjub order. The
+// challenge also covers ctx, so the proof only verifies with the same ctx.
+func proveDLEQ(ctx []byte, g, G, h, H *twistededwards.PointAffine, x *fr.Element) (*DLEQProof, error) {
+	xl := x.Bits()
+	defer wipeLimbs(&xl)
+	if ctLess(xl, jubjubOrder) == 0 {
+		return nil, errors.New("secret is not reduced modulo the Jubjub order")
+	}
+	r, err := randJubjubScalar()
+	if err != nil {
+		return nil, fmt.Errorf("fail to generate random number: %w", err)
+	}
+	defer wipeElement(r)
+	rl := r.Bits()
+	defer wipeLimbs(&rl)
+
+	A1 := jubjubMul(g, r)
+	A2 := jubjubMul(h, r)
+	c := dleqChallenge(ctx, g, G, h, H, A1, A2)
+	z := ctAddMod(rl, ctMulPubMod(xl, bigToLimbs(c), jubjubOrder), jubjubOrder)
+	return &DLEQProof{c, limbsToBig(z)}, nil
+}
+
+func verifyDLEQ(ctx []byte, g, G, h, H *twistededwards.PointAffine, pf *DLEQProof) error {
+	curve := twistededwards.GetEdwardsCurve()
+	if pf.c == nil || pf.z == nil || pf.z.Sign() < 0 || pf.z.Cmp(&curve.Order) >= 0 {
+		return errors.New("dleq proof is invalid, malformed response")
+	}
+	negC := new(big.Int).Neg(pf.c)
+	A1_ := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(g, pf.z), new(twistededwards.PointAffine).ScalarMultiplication(G, negC))
+	A2_ := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(h, pf.z), new(twistededwards.PointAffine).ScalarMultiplication(H, negC))
+	if dleqChallenge(ctx, g, G, h, H, A1_, A2_).Cmp(pf.c) != 0 {
+		return errors.New("dleq proof is invalid, c mismatch")
+	}
+	return nil
+}
+
+func dleqChallenge(ctx []byte, points ...*twistededwards.PointAffine) *big.Int {
+	arr := []byte("PKEET-VPG/DLEQ")
+	arr = binary.BigEndian.AppendUint32(arr, uint32(len(ctx)))
+	arr = append(arr, ctx...)
+	for _, P := range points {
+		arr = append(arr, P.Marshal()...)
+	}
+	res := sha256.Sum256(arr)
+	curve := twistededwards.GetEdwardsCurve()
+	return new(big.Int).Mod(new(big.Int).SetBytes(res[:]), &curve.Order)
+}
+
+// marshal encodes the proof as c || z, 32 bytes each
+func (pf *DLEQProof) marshal() []byte {
+	c := BigIntToFixed32Bytes(pf.c)
+	z := BigIntToFixed32Bytes(pf.z)
+	return append(c[:], z[:]...)
+}
+
+func unmarshalDLEQ(b []byte) (*DLEQProof, error) {
+	if len(b) != 64 {
+		return nil, errors.New("malformed dleq proof")
+	}
+	return &DLEQProof{new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:])}, nil
+}
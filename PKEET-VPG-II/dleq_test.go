@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestDLEQ(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	x, _ := randJubjubScalar()
+	y, _ := randJubjubScalar()
+	g := &curve.Base
+	h := jubjubMul(g, y)
+	G := jubjubMul(g, x)
+	H := jubjubMul(h, x)
+
+	pf, err := proveDLEQ(nil, g, G, h, H, x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, verifyDLEQ(nil, g, G, h, H, pf))
+
+	pf_, err := unmarshalDLEQ(pf.marshal())
+	assert.Nil(t, err)
+	assert.Nil(t, verifyDLEQ(nil, g, G, h, H, pf_))
+
+	// H under a different exponent
+	assert.NotNil(t, verifyDLEQ(nil, g, G, h, G, pf))
+	// z shifted by the group order
+	assert.NotNil(t, verifyDLEQ(nil, g, G, h, H, &DLEQProof{pf.c, new(big.Int).Add(pf.z, &curve.Order)}))
+	assert.NotNil(t, verifyDLEQ(nil, g, G, h, H, &DLEQProof{pf.c, new(big.Int).Add(pf.z, big.NewInt(1))}))
+}
+
+func TestDecryptWithProof(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+
+	rd, err := DialDecrypter(startDecrypter(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	for _, d := range []ProvingDecrypter{key, rd} {
+		x, _ := randJubjubScalar()
+		v, _ := randJubjubScalar()
+		m := jubjubMul(crs.gj, x)
+		ct, err := Enc(crs, key.pk, 0, m, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m_, proof, err := DecryptWithProof(crs, ct, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, m, m_)
+		assert.Nil(t, VerifyDecryption(crs, key.pk, ct, m_, proof))
+
+		// a different plaintext
+		other := new(twistededwards.PointAffine).Add(m, crs.gj)
+		assert.NotNil(t, VerifyDecryption(crs, key.pk, ct, other, proof))
+
+		// a different key
+		assert.NotNil(t, VerifyDecryption(crs, crs.gj, ct, m, proof))
+
+		// a forged Y
+		forged := &DecProof{new(twistededwards.PointAffine).Add(proof.Y, crs.gj), proof.DLEQProof}
+		assert.NotNil(t, VerifyDecryption(crs, key.pk, ct, m, forged))
+
+		// a forged challenge
+		c := new(big.Int).Add(proof.c, big.NewInt(1))
+		assert.NotNil(t, VerifyDecryption(crs, key.pk, ct, m, &DecProof{proof.Y, &DLEQProof{c, proof.z}}))
+
+		assert.NotNil(t, VerifyDecryption(crs, key.pk, ct, m, nil))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	twistededwards2 "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/frontend"
+	twistededwards1 "github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"github.com/consensys/gnark/std/hash/mimc"
+)
+
+// Equality test. Jubjub has no pairing, so the test cannot run on U and V
+// alone, and anything that unmasks the W masks also reveals m. A testable
+// ciphertext therefore carries two tags
+//
+//	TU = MiMC(m) + MiMC(ZU, U, eqTag)    with ZU = tpkU^v = U^tdU
+//	TC = MiMC(m) + MiMC(ZC, U, eqCtTag)  with ZC = tpkC^v = U^tdC
+//
+// where tdU and tdC are independent trapdoor scalars derived from the
+// supervisor key and tpkU, tpkC their public parts. The holder of tdU recovers
+// MiMC(m) from any testable ciphertext, while ZC opens TC of one ciphertext
+// only, and neither reveals Y, v or m itself. Only tags proven in
+// TagPKECricuit bind the m of the ciphertext: ProofTest makes them and
+// VerifyTest checks them, while EncTest tags are taken on trust. The tag
+// circuit builds on VEPKECricuit, so its public witness holds no Y either.
+
+// eqTag and eqCtTag separate the tag masks from each other, the W masks and
+// the payload key
+const (
+	eqTag   = 5
+	eqCtTag = 6
+)
+
+// EqTag is the equality-test part of a ciphertext
+type EqTag struct {
+	User fr.Element
+	Ct   fr.Element
+}
+
+// TrapdoorKey is the public part of a trapdoor, which encryptors need for
+// testable ciphertexts
+type TrapdoorKey struct {
+	User *twistededwards.PointAffine
+	Ct   *twistededwards.PointAffine
+}
+
+// Trapdoor lets its holder test ciphertexts of one supervisor key for equal m
+// and hand out tokens for narrower tests
+type Trapdoor struct {
+	tdU SecretScalar
+	tdC SecretScalar
+	pk  *TrapdoorKey
+}
+
+// Trapdoor derives the equality-test trapdoor of key. It is a one-way function
+// of sk, so the supervisor can regenerate it and a tester cannot decrypt.
+func (key *Key) Trapdoor(crs *PKECRS) *Trapdoor {
+	tdU := trapdoorScalar(key, "PKEET-VPG/EqTrapdoor/User")
+	tdC := trapdoorScalar(key, "PKEET-VPG/EqTrapdoor/Ciphertext")
+	return &Trapdoor{SecretScalar{tdU}, SecretScalar{tdC}, &TrapdoorKey{jubjubMul(crs.gj, tdU), jubjubMul(crs.gj, tdC)}}
+}
+
+func trapdoorScalar(key *Key, label string) *fr.Element {
+	h := sha256.New()
+	h.Write([]byte(label))
+	skb := key.sk.element().Bytes()
+	h.Write(skb[:])
+	wipeBytes(skb[:])
+	var buf [32]byte
+	h.Sum(buf[:0])
+	l := bytesToLimbs(&buf)
+	wipeBytes(buf[:])
+	// 2^251 < p, so the low 251 bits are a scalar below the Jubjub order
+	td, _ := splitLimbs(l, 251)
+	wipeLimbs(&l)
+	e := frFromLimbs(td)
+	wipeLimbs(&td)
+	return e
+}
+
+// PublicKey returns the trapdoor key (gj^tdU, gj^tdC)
+func (td *Trapdoor) PublicKey() *TrapdoorKey {
+	return td.pk
+}
+
+func (td *Trapdoor) Destroy() {
+	td.tdU.Destroy()
+	td.tdC.Destroy()
+}
+
+// EpochTrapdoorKeys gives the trapdoor key of an epoch to a verifier of tagged
+// proofs
+type EpochTrapdoorKeys interface {
+	TrapdoorKey(epoch uint32) (*TrapdoorKey, error)
+}
+
+// PublicTrapdoorKeys maps epochs to trapdoor keys
+type PublicTrapdoorKeys map[uint32]*TrapdoorKey
+
+func (tk PublicTrapdoorKeys) TrapdoorKey(epoch uint32) (*TrapdoorKey, error) {
+	key, ok := tk[epoch]
+	if !ok {
+		return nil, fmt.Errorf("keyring: no trapdoor key for epoch %d", epoch)
+	}
+	return key, nil
+}
+
+func checkTrapdoorKey(tpk *TrapdoorKey) error {
+	if tpk == nil {
+		return errors.New("missing trapdoor key")
+	}
+	if err := checkJubjubPoint(tpk.User); err != nil {
+		return err
+	}
+	return checkJubjubPoint(tpk.Ct)
+}
+
+// EncTest is Enc with equality-test tags for the trapdoor behind tpk
+func EncTest(crs *PKECRS, pk *twistededwards.PointAffine, tpk *TrapdoorKey, epoch uint32, m *twistededwards.PointAffine, v *fr.Element) (*Ciphertext, error) {
+	if err := checkTrapdoorKey(tpk); err != nil {
+		return nil, err
+	}
+	ct, err := Enc(crs, pk, epoch, m, v)
+	if err != nil {
+		return nil, err
+	}
+	ct.Tag = eqTagOf(ct, m, tpk, v)
+	return ct, nil
+}
+
+// eqTagOf is the tag of ct for m with nonce v
+func eqTagOf(ct *Ciphertext, m *twistededwards.PointAffine, tpk *TrapdoorKey, v *fr.Element) *EqTag {
+	digest := mimcElements(&m.X, &m.Y)
+	maskU := eqMask(ct.U, jubjubMul(tpk.User, v), eqTag)
+	maskC := eqMask(ct.U, jubjubMul(tpk.Ct, v), eqCtTag)
+	tag := &EqTag{}
+	tag.User.Add(&digest, &maskU)
+	tag.Ct.Add(&digest, &maskC)
+	return tag
+}
+
+func eqMask(U, Z *twistededwards.PointAffine, scope uint64) fr.Element {
+	var tag fr.Element
+	tag.SetUint64(scope)
+	return mimcElements(&Z.X, &Z.Y, &U.X, &U.Y, &tag)
+}
+
+// eqDigest unmasks MiMC(m) from the tag of ct for scope, eqTag or eqCtTag,
+// with the matching Z
+func eqDigest(ct *Ciphertext, Z *twistededwards.PointAffine, scope uint64) (fr.Element, error) {
+	var digest fr.Element
+	if ct.Tag == nil {
+		return digest, errors.New("ciphertext has no equality-test tag")
+	}
+	mask := eqMask(ct.U, Z, scope)
+	if scope == eqCtTag {
+		digest.Sub(&ct.Tag.Ct, &mask)
+	} else {
+		digest.Sub(&ct.Tag.User, &mask)
+	}
+	return digest, nil
+}
+
+// digest recovers MiMC(m) from a ciphertext of the supervisor of td
+func (td *Trapdoor) digest(ct *Ciphertext) (fr.Element, error) {
+	if err := checkJubjubPoint(ct.U); err != nil {
+		return fr.Element{}, err
+	}
+	return eqDigest(ct, jubjubMul(ct.U, td.tdU.element()), eqTag)
+}
+
+// Test tells whether ct1 and ct2, both testable under td, encrypt the same m
+func Test(ct1, ct2 *Ciphertext, td *Trapdoor) (bool, error) {
+	d1, err := td.digest(ct1)
+	if err != nil {
+		return false, err
+	}
+	d2, err := td.digest(ct2)
+	if err != nil {
+		return false, err
+	}
+	return d1.Equal(&d2), nil
+}
+
+// TagPKECricuit is VEPKECricuit plus the equality-test tags of the ciphertext
+// for the trapdoor key (TPKU, TPKC)
+type TagPKECricuit struct {
+	VEPKECricuit
+
+	TPKUX frontend.Variable `gnark:",public"`
+	TPKUY frontend.Variable `gnark:",public"`
+	TPKCX frontend.Variable `gnark:",public"`
+	TPKCY frontend.Variable `gnark:",public"`
+	TagU  frontend.Variable `gnark:",public"`
+	TagC  frontend.Variable `gnark:",public"`
+}
+
+// Positions of the public inputs TagPKECricuit adds after those of
+// VEPKECricuit
+const (
+	tpubTPKUX = vpubKID + 1 + iota
+	tpubTPKUY
+	tpubTPKCX
+	tpubTPKCY
+	tpubTagU
+	tpubTagC
+)
+
+func (circuit *TagPKECricuit) Define(api frontend.API) error {
+	if _, err := circuit.VEPKECricuit.define(api); err != nil {
+		return err
+	}
+	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
+	if err != nil {
+		panic(err)
+	}
+	TPKU := twistededwards1.Point{
+		X: circuit.TPKUX,
+		Y: circuit.TPKUY,
+	}
+	TPKC := twistededwards1.Point{
+		X: circuit.TPKCX,
+		Y: circuit.TPKCY,
+	}
+	ZU := curve.ScalarMul(TPKU, circuit.V)
+	ZC := curve.ScalarMul(TPKC, circuit.V)
+
+	miMC, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	miMC.Write(circuit.MX, circuit.MY)
+	digest := miMC.Sum()
+	miMC.Reset()
+	miMC.Write(ZU.X, ZU.Y, circuit.UX, circuit.UY, eqTag)
+	api.AssertIsEqual(circuit.TagU, api.Add(digest, miMC.Sum()))
+	miMC.Reset()
+	miMC.Write(ZC.X, ZC.Y, circuit.UX, circuit.UY, eqCtTag)
+	api.AssertIsEqual(circuit.TagC, api.Add(digest, miMC.Sum()))
+	return nil
+}
+
+// tagAssign tags the ciphertext for tpk and assigns it in TagPKECricuit
+func tagAssign(tpk *TrapdoorKey) encAssign {
+	return func(base *PKECricuit, ct *Ciphertext, m, _ *twistededwards.PointAffine, v *fr.Element) frontend.Circuit {
+		ct.Tag = eqTagOf(ct, m, tpk, v)
+		return &TagPKECricuit{veAssignment(base), tpk.User.X, tpk.User.Y, tpk.Ct.X, tpk.Ct.Y, ct.Tag.User, ct.Tag.Ct}
+	}
+}
+
+// checkTagInputs checks tpk and the tags of ct against the public witness of
+// TagPKECricuit
+func checkTagInputs(ct *Ciphertext, tpk *TrapdoorKey, pub fr.Vector) error {
+	if len(pub) <= tpubTagC {
+		return errors.New("malformed public witness")
+	}
+	if !tpk.User.X.Equal(&pub[tpubTPKUX]) || !tpk.User.Y.Equal(&pub[tpubTPKUY]) || !tpk.Ct.X.Equal(&pub[tpubTPKCX]) || !tpk.Ct.Y.Equal(&pub[tpubTPKCY]) {
+		return errors.New("trapdoor key does not match the snark statement")
+	}
+	if !ct.Tag.User.Equal(&pub[tpubTagU]) || !ct.Tag.Ct.Equal(&pub[tpubTagC]) {
+		return errors.New("equality-test tag does not match the snark statement")
+	}
+	return nil
+}
+
+// checkNoTag rejects a tag on ct from a statement that does not prove one
+func checkNoTag(ct *Ciphertext) error {
+	if ct.Tag != nil {
+		return errors.New("equality-test tag is not in the snark statement")
+	}
+	return nil
+}
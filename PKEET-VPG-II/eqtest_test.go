@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEqualityTest(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+	td := key.Trapdoor(crs)
+
+	// the trapdoor is deterministic and is not the decryption key
+	assert.Equal(t, td.PublicKey(), key.Trapdoor(crs).PublicKey())
+	assert.False(t, td.PublicKey().User.Equal(key.pk))
+	assert.False(t, td.PublicKey().User.Equal(td.PublicKey().Ct))
+
+	enc := func(x *twistededwards.PointAffine) *Ciphertext {
+		v, _ := randJubjubScalar()
+		ct, err := EncTest(crs, key.pk, td.PublicKey(), 1, x, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ct
+	}
+	x1, _ := randJubjubScalar()
+	x2, _ := randJubjubScalar()
+	m1, m2 := jubjubMul(crs.gj, x1), jubjubMul(crs.gj, x2)
+	a, b, c := enc(m1), enc(m1), enc(m2)
+
+	eq, err := Test(a, b, td)
+	assert.Nil(t, err)
+	assert.True(t, eq)
+	eq, err = Test(a, c, td)
+	assert.Nil(t, err)
+	assert.False(t, eq)
+
+	// testable ciphertexts still decrypt
+	m_, err := Dec(crs, c, key)
+	assert.Nil(t, err)
+	assert.True(t, m2.Equal(m_))
+
+	// another supervisor's trapdoor learns nothing
+	sk2, _ := RandSecretJubjub()
+	other := (&Key{sk2, jubjubMul(crs.gj, sk2.element())}).Trapdoor(crs)
+	eq, err = Test(a, b, other)
+	assert.Nil(t, err)
+	assert.False(t, eq)
+
+	// plain ciphertexts cannot be tested
+	v, _ := randJubjubScalar()
+	plain, _ := Enc(crs, key.pk, 1, m1, v)
+	_, err = Test(a, plain, td)
+	assert.NotNil(t, err)
+
+	// a destroyed trapdoor no longer matches
+	td.Destroy()
+	eq, _ = Test(a, b, td)
+	assert.False(t, eq)
+}
+
+func TestPKEETVPGTag(t *testing.T) {
+	// 1. Setup
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &TagPKECricuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	pkeCrs := &PKECRS{&curve.Base, getRandomG()}
+	_, _, g1, g2 := bls12381.Generators()
+	pokCrs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH)
+
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+	td := key.Trapdoor(pkeCrs)
+	keys, tpks := PublicKeyring{3: key.pk}, PublicTrapdoorKeys{3: td.PublicKey()}
+
+	// 2. user
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+	pvp, err := user.ProofTest(crs, key.pk, td.PublicKey(), 3, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, VerifyTest(crs, keys, tpks, ctxH, pvp))
+	assert.NotNil(t, Verify(crs, keys, ctxH, pvp))
+	assert.NotNil(t, VerifyTest(crs, keys, PublicTrapdoorKeys{3: {key.pk, td.PublicKey().Ct}}, ctxH, pvp))
+
+	// the public witness does not hold Y, which opens the ciphertext
+	Y := jubjubMul(pvp.ct.U, sk.element())
+	for _, e := range pvp.pubWit.Vector().(fr.Vector) {
+		assert.False(t, e.Equal(&Y.X) || e.Equal(&Y.Y))
+	}
+
+	// 3. tester: the proven tag matches a ciphertext of the same m
+	v, _ := randJubjubScalar()
+	m := jubjubMul(pkeCrs.gj, x.element())
+	same, _ := EncTest(pkeCrs, key.pk, td.PublicKey(), 3, m, v)
+	eq, err := Test(pvp.Ciphertext(), same, td)
+	assert.Nil(t, err)
+	assert.True(t, eq)
+
+	// a tag for another m, or none, is rejected
+	ct := pvp.Ciphertext()
+	saved := ct.Tag
+	other, _ := randJubjubScalar()
+	ct.Tag = eqTagOf(ct, jubjubMul(pkeCrs.gj, other), td.PublicKey(), v)
+	assert.NotNil(t, VerifyTest(crs, keys, tpks, ctxH, pvp))
+	ct.Tag = &EqTag{saved.User, *new(fr.Element).Add(&saved.Ct, new(fr.Element).SetOne())}
+	assert.NotNil(t, VerifyTest(crs, keys, tpks, ctxH, pvp))
+	ct.Tag = nil
+	assert.NotNil(t, VerifyTest(crs, keys, tpks, ctxH, pvp))
+	ct.Tag = saved
+	assert.Nil(t, VerifyTest(crs, keys, tpks, ctxH, pvp))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"math/big"
+)
+
+// The variable public generator H is not sampled by anyone: it is the RFC 9380
+// hash of a public context, such as the batch a service provider collects
+// records for, so nobody knows its discrete log to g or h and anyone holding
+// the context can recompute it.
+
+// The same goes for the CRS: every generator that must have no known discrete
+// log to the others is hashed from a labelled seed, so the setup holds no
+// trapdoor and VerifyCRS can recompute it. The fixed generators are the Jubjub
+// base point gj and the standard BLS12-381 generators g and g_. The CGPoK
+// generators are those of the PKE and PoK parts, see (*CRS).CGCRS.
+
+// Domain separation tags of H, of the CRS generators in G1, and of Jubjub
+// points. Jubjub has no RFC 9380 suite, so HashToJubjub uses try-and-increment
+// on the RFC 9380 hash_to_field of BLS12-381 fr.
+const (
+	hDST        = "PKEET-VPG-V01-CS01-with-BLS12381G1_XMD:SHA-256_SSWU_RO_H_"
+	crsDST      = "PKEET-VPG-V01-CS01-with-BLS12381G1_XMD:SHA-256_SSWU_RO_CRS_"
+	jubjubDST   = "PKEET-VPG-V01-CS01-with-Jubjub_XMD:SHA-256_TAI_CRS_"
+	hjSeed      = "PKECRS/hj"
+	pokHSeed    = "PoKCRS/h"
+	maxTAITries = 256
+)
+
+// HashToG1 hashes context to G1 with the RFC 9380 random-oracle suite
+// BLS12381G1_XMD:SHA-256_SSWU_RO_ under the tag domain
+func HashToG1(domain, context []byte) (*bls12381.G1Affine, error) {
+	if len(domain) == 0 {
+		return nil, errors.New("empty hash-to-curve domain")
+	}
+	P, err := bls12381.HashToG1(context, domain)
+	if err != nil {
+		return nil, err
+	}
+	return &P, nil
+}
+
+// DeriveH returns the variable public generator of context
+func DeriveH(context []byte) (*bls12381.G1Affine, error) {
+	return HashToG1([]byte(hDST), context)
+}
+
+// checkH checks that the PoK was made with the H of context
+func checkH(pkp *PoKProof, context []byte) error {
+	H, err := DeriveH(context)
+	if err != nil {
+		return err
+	}
+	if pkp == nil || pkp.H == nil || !pkp.H.Equal(H) {
+		return errors.New("H does not match the context")
+	}
+	return nil
+}
+
+// Audit checks that the generator of the batch is the H of its context
+func (b *RBatch) Audit() error {
+	h, err := DeriveH(b.ctx)
+	if err != nil {
+		return err
+	}
+	if !b.h.Equal(h) {
+		return errors.New("batch generator does not match its context")
+	}
+	return nil
+}
+
+// HashToJubjub hashes seed to the Jubjub prime subgroup under the tag domain.
+// It tries y = hash_to_field(seed || ctr) for ctr = 0, 1, ... until y is on the
+// curve, then clears the cofactor.
+func HashToJubjub(domain, seed []byte) (*twistededwards.PointAffine, error) {
+	if len(domain) == 0 {
+		return nil, errors.New("empty hash-to-curve domain")
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	var one fr.Element
+	one.SetOne()
+	msg := make([]byte, len(seed)+4)
+	copy(msg, seed)
+	for ctr := uint32(0); ctr < maxTAITries; ctr++ {
+		binary.BigEndian.PutUint32(msg[len(seed):], ctr)
+		ys, err := fr.Hash(msg, domain, 1)
+		if err != nil {
+			return nil, err
+		}
+		// x^2 = (1 - y^2) / (a - d y^2)
+		var y2, num, den, x fr.Element
+		y2.Square(&ys[0])
+		num.Sub(&one, &y2)
+		den.Mul(&y2, &curve.D)
+		den.Sub(&curve.A, &den)
+		if den.IsZero() {
+			continue
+		}
+		x.Div(&num, &den)
+		if x.Sqrt(&x) == nil {
+			continue
+		}
+		P := twistededwards.NewPointAffine(x, ys[0])
+		var cofactor big.Int
+		curve.Cofactor.BigInt(&cofactor)
+		P.ScalarMultiplication(&P, &cofactor)
+		if P.IsZero() || !P.IsOnCurve() {
+			continue
+		}
+		return &P, nil
+	}
+	return nil, errors.New("hash to Jubjub failed")
+}
+
+// NewPKECRS returns the PKE CRS with gj the Jubjub base point and hj hashed
+func NewPKECRS() (*PKECRS, error) {
+	curve := twistededwards.GetEdwardsCurve()
+	hj, err := HashToJubjub([]byte(jubjubDST), []byte(hjSeed))
+	if err != nil {
+		return nil, err
+	}
+	return &PKECRS{&curve.Base, hj}, nil
+}
+
+// GenPoKCRS returns the PoK CRS with g, g_ the standard generators and h hashed
+func GenPoKCRS() (*PoKCRS, error) {
+	_, _, g1, g2 := bls12381.Generators()
+	h, err := HashToG1([]byte(crsDST), []byte(pokHSeed))
+	if err != nil {
+		return nil, err
+	}
+	return NewPoKCRS(&g1, h, &g2), nil
+}
+
+// CGCRS returns the CGPoK CRS of crs: B and C are commitments under (gj, hj)
+// and (g, h), so the cross-group proof uses the same generators
+func (crs *CRS) CGCRS() *CGCRS {
+	return NewCGCRS(bc, bx, bf, tau, crs.gj, crs.hj, crs.g, crs.h)
+}
+
+// VerifyCRS recomputes every generator of crs from its seed. This covers the
+// CGPoK, whose generators are taken from crs.
+func VerifyCRS(crs *CRS) error {
+	pkeCrs, err := NewPKECRS()
+	if err != nil {
+		return err
+	}
+	pokCrs, err := GenPoKCRS()
+	if err != nil {
+		return err
+	}
+	if crs.PKECRS == nil || !crs.gj.Equal(pkeCrs.gj) || !crs.hj.Equal(pkeCrs.hj) {
+		return errors.New("PKE CRS is not the nothing-up-my-sleeve one")
+	}
+	if crs.PoKCRS == nil || !crs.g.Equal(pokCrs.g) || !crs.h.Equal(pokCrs.h) || !crs.g_.Equal(pokCrs.g_) {
+		return errors.New("PoK CRS is not the nothing-up-my-sleeve one")
+	}
+	return nil
+}
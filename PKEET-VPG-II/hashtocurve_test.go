@@ -0,0 +1,73 @@
+package main
+
+import (
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHashToG1(t *testing.T) {
+	// RFC 9380, appendix J.9.1, msg = ""
+	P, err := HashToG1([]byte("QUUX-V01-CS02-with-BLS12381G1_XMD:SHA-256_SSWU_RO_"), []byte(""))
+	assert.Nil(t, err)
+	var want bls12381.G1Affine
+	want.X.SetString("0x052926add2207b76ca4fa57a8734416c8dc95e24501772c814278700eed6d1e4e8cf62d9c09db0fac349612b759e79a1")
+	want.Y.SetString("0x08ba738453bfed09cb546dbb0783dbb3a5f1f566ed67bb6be0e8c67e2e81a4cc68ee29813bb7994998f3eae0c9c6a265")
+	assert.True(t, want.Equal(P))
+
+	_, err = HashToG1(nil, []byte("ctx"))
+	assert.NotNil(t, err)
+
+	H1, _ := DeriveH([]byte("batch/1"))
+	H1_, _ := DeriveH([]byte("batch/1"))
+	H2, _ := DeriveH([]byte("batch/2"))
+	assert.True(t, H1.Equal(H1_))
+	assert.False(t, H1.Equal(H2))
+	assert.True(t, H1.IsInSubGroup())
+}
+
+func TestRBatchAudit(t *testing.T) {
+	groups, err := GenerateRecordsLight(getRandomG2(), 6, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range groups {
+		assert.Nil(t, b.Audit())
+	}
+	groups[0].h = getRandomG1()
+	assert.NotNil(t, groups[0].Audit())
+	groups[1].ctx = batchContext(2)
+	assert.NotNil(t, groups[1].Audit())
+}
+
+func TestCRSGeneration(t *testing.T) {
+	pkeCrs, err := NewPKECRS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pokCrs, err := GenPoKCRS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crs := &CRS{nil, nil, nil, pkeCrs, pokCrs}
+	assert.Nil(t, VerifyCRS(crs))
+
+	// hj is a fixed point of the prime subgroup, other than gj
+	curve := twistededwards.GetEdwardsCurve()
+	assert.True(t, pkeCrs.hj.IsOnCurve())
+	assert.False(t, pkeCrs.hj.Equal(pkeCrs.gj))
+	assert.True(t, new(twistededwards.PointAffine).ScalarMultiplication(pkeCrs.hj, &curve.Order).IsZero())
+	hj, _ := HashToJubjub([]byte(jubjubDST), []byte(hjSeed))
+	assert.True(t, hj.Equal(pkeCrs.hj))
+	other, _ := HashToJubjub([]byte(jubjubDST), []byte("other"))
+	assert.False(t, other.Equal(hj))
+	assert.True(t, pokCrs.h.IsInSubGroup())
+
+	// a setup with random generators is rejected
+	assert.NotNil(t, VerifyCRS(&CRS{nil, nil, nil, &PKECRS{pkeCrs.gj, getRandomG()}, pokCrs}))
+	assert.NotNil(t, VerifyCRS(&CRS{nil, nil, nil, pkeCrs, NewPoKCRS(pokCrs.g, getRandomG1(), pokCrs.g_)}))
+
+	cg := crs.CGCRS()
+	assert.True(t, cg.Hp.Equal(pkeCrs.hj) && cg.Hq.Equal(pokCrs.h))
+}
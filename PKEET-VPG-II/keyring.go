@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"sort"
+	"sync"
+)
+
+// Keyring holds the supervisor keys of every epoch still in use. New
+// ciphertexts are made under the current epoch, and Dec routes a ciphertext to
+// the key of its own epoch. The keys are Decrypters, so an epoch may live in
+// memory, behind a socket or be served by a threshold combiner.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[uint32]Decrypter
+	current uint32
+	started bool
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[uint32]Decrypter)}
+}
+
+// Add registers the key of an epoch without making it current, e.g. to load
+// old epochs from keystores
+func (kr *Keyring) Add(epoch uint32, d Decrypter) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.add(epoch, d)
+}
+
+func (kr *Keyring) add(epoch uint32, d Decrypter) error {
+	if _, ok := kr.keys[epoch]; ok {
+		return fmt.Errorf("keyring: epoch %d already has a key", epoch)
+	}
+	for e, other := range kr.keys {
+		if other.PublicKey().Equal(d.PublicKey()) {
+			return fmt.Errorf("keyring: key of epoch %d reused for epoch %d", e, epoch)
+		}
+	}
+	kr.keys[epoch] = d
+	return nil
+}
+
+// Rotate adds the key of a new epoch and makes it current. Epochs only move
+// forward.
+func (kr *Keyring) Rotate(epoch uint32, d Decrypter) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if kr.started && epoch <= kr.current {
+		return fmt.Errorf("keyring: epoch %d is not after the current epoch", epoch)
+	}
+	if err := kr.add(epoch, d); err != nil {
+		return err
+	}
+	kr.current, kr.started = epoch, true
+	return nil
+}
+
+// Current returns the epoch and public key new ciphertexts should use
+func (kr *Keyring) Current() (uint32, *twistededwards.PointAffine, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if !kr.started {
+		return 0, nil, errors.New("keyring: no current epoch")
+	}
+	return kr.current, kr.keys[kr.current].PublicKey(), nil
+}
+
+// Decrypter returns the key of an epoch
+func (kr *Keyring) Decrypter(epoch uint32) (Decrypter, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	d, ok := kr.keys[epoch]
+	if !ok {
+		return nil, fmt.Errorf("keyring: no key for epoch %d", epoch)
+	}
+	return d, nil
+}
+
+// PublicKey returns the public key of an epoch
+func (kr *Keyring) PublicKey(epoch uint32) (*twistededwards.PointAffine, error) {
+	d, err := kr.Decrypter(epoch)
+	if err != nil {
+		return nil, err
+	}
+	return d.PublicKey(), nil
+}
+
+// EpochKeys gives the supervisor key of an epoch to a verifier, which checks
+// that a proof encrypts to the key of the epoch it claims. Keyring is one;
+// PublicKeyring serves verifiers that hold no secrets.
+type EpochKeys interface {
+	PublicKey(epoch uint32) (*twistededwards.PointAffine, error)
+}
+
+// PublicKeyring maps epochs to supervisor public keys
+type PublicKeyring map[uint32]*twistededwards.PointAffine
+
+func (pk PublicKeyring) PublicKey(epoch uint32) (*twistededwards.PointAffine, error) {
+	key, ok := pk[epoch]
+	if !ok {
+		return nil, fmt.Errorf("keyring: no key for epoch %d", epoch)
+	}
+	return key, nil
+}
+
+// Epochs lists the epochs in the keyring in increasing order
+func (kr *Keyring) Epochs() []uint32 {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	res := make([]uint32, 0, len(kr.keys))
+	for e := range kr.keys {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// Retire drops the key of an old epoch and destroys it if it is held in memory.
+// Ciphertexts of that epoch can no longer be opened.
+func (kr *Keyring) Retire(epoch uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if kr.started && epoch == kr.current {
+		return errors.New("keyring: cannot retire the current epoch")
+	}
+	d, ok := kr.keys[epoch]
+	if !ok {
+		return fmt.Errorf("keyring: no key for epoch %d", epoch)
+	}
+	delete(kr.keys, epoch)
+	if key, ok := d.(*Key); ok {
+		key.Destroy()
+	}
+	return nil
+}
+
+// Dec opens ct with the key of ct.Epoch
+func (kr *Keyring) Dec(crs *PKECRS, ct *Ciphertext) (*twistededwards.PointAffine, error) {
+	d, err := kr.Decrypter(ct.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	return Dec(crs, ct, d)
+}
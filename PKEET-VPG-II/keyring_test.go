@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	newKey := func() *Key {
+		sk, _ := RandSecretJubjub()
+		return &Key{sk, jubjubMul(crs.gj, sk.element())}
+	}
+
+	kr := NewKeyring()
+	_, _, err := kr.Current()
+	assert.NotNil(t, err)
+
+	// encrypt one message per epoch, rotating in between
+	keys := []*Key{newKey(), newKey(), newKey()}
+	var cts []*Ciphertext
+	var ms []*twistededwards.PointAffine
+	for i, key := range keys {
+		assert.Nil(t, kr.Rotate(uint32(i+1), key))
+		epoch, pk, err := kr.Current()
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(i+1), epoch)
+
+		x, _ := randJubjubScalar()
+		v, _ := randJubjubScalar()
+		m := jubjubMul(crs.gj, x)
+		ct, err := Enc(crs, pk, epoch, m, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cts = append(cts, ct)
+		ms = append(ms, m)
+	}
+	assert.Equal(t, []uint32{1, 2, 3}, kr.Epochs())
+	pk, err := kr.PublicKey(2)
+	assert.Nil(t, err)
+	assert.True(t, pk.Equal(keys[1].pk))
+	_, err = kr.PublicKey(4)
+	assert.NotNil(t, err)
+
+	// every ciphertext is routed to the key of its epoch
+	for i, ct := range cts {
+		m_, err := kr.Dec(crs, ct)
+		assert.Nil(t, err)
+		assert.Equal(t, ms[i], m_)
+	}
+
+	// a ciphertext relabelled to another epoch does not decrypt, even under
+	// the right key
+	relabelled := *cts[0]
+	relabelled.Epoch = 2
+	_, err = kr.Dec(crs, &relabelled)
+	assert.NotNil(t, err)
+	_, err = Dec(crs, &relabelled, keys[0])
+	assert.NotNil(t, err)
+
+	// epochs only move forward and keys are not reused
+	assert.NotNil(t, kr.Rotate(2, newKey()))
+	assert.NotNil(t, kr.Add(7, keys[1]))
+	assert.Nil(t, kr.Add(0, newKey()))
+
+	assert.NotNil(t, kr.Retire(3))
+	assert.Nil(t, kr.Retire(1))
+	_, err = kr.Dec(crs, cts[0])
+	assert.NotNil(t, err)
+	assert.True(t, keys[0].sk.element().IsZero())
+}
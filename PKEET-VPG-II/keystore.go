@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"os"
+	"path/filepath"
+)
+
+// A keystore is a JSON document holding a supervisor key sk or a user opening
+// (x, k) of C, sealed with XChaCha20-Poly1305 under a key derived from a password
+// with argon2id. Everything except the ciphertext is authenticated as AAD.
+
+const (
+	keystoreVersion = 1
+	keystoreKDF     = "argon2id"
+	keystoreCipher  = "xchacha20-poly1305"
+
+	KeystoreSupervisor = "supervisor"
+	KeystoreUser       = "user"
+)
+
+// KDFParams are the argon2id parameters, Memory is in KiB
+type KDFParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultKDFParams follows the second recommendation of RFC 9106
+var DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// maxKDFMemory bounds the memory a keystore file can make us allocate (4 GiB)
+const maxKDFMemory = 4 * 1024 * 1024
+
+type keystoreKDFHeader struct {
+	Name string `json:"name"`
+	Salt string `json:"salt"`
+	KDFParams
+}
+
+type keystoreCipherHeader struct {
+	Name  string `json:"name"`
+	Nonce string `json:"nonce"`
+}
+
+type keystoreHeader struct {
+	Version int                  `json:"version"`
+	Type    string               `json:"type"`
+	ID      string               `json:"id"`
+	Public  string               `json:"public"`
+	KDF     keystoreKDFHeader    `json:"kdf"`
+	Cipher  keystoreCipherHeader `json:"cipher"`
+}
+
+type keystoreFile struct {
+	keystoreHeader
+	Ciphertext string `json:"ciphertext"`
+}
+
+// KeyID identifies a public key: the first 16 bytes of SHA-256 over a domain
+// separator, the keystore type and the compressed public key
+func KeyID(typ string, public []byte) string {
+	arr := append([]byte("PKEET-VPG keystore/"+typ+"/"), public...)
+	res := sha256.Sum256(arr)
+	return hex.EncodeToString(res[:16])
+}
+
+// EncryptKey seals the supervisor key. The identifier is derived from pk.
+func EncryptKey(key *Key, password []byte, params KDFParams) ([]byte, error) {
+	pk := key.pk.Marshal()
+	sk := key.sk.element().Bytes()
+	defer wipeBytes(sk[:])
+	return sealKeystore(KeystoreSupervisor, pk, sk[:], password, params)
+}
+
+// DecryptKey opens a supervisor keystore and checks that sk matches the stored pk
+func DecryptKey(crs *PKECRS, data, password []byte) (*Key, error) {
+	hdr, pt, err := openKeystore(KeystoreSupervisor, data, password)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(pt)
+	if len(pt) != fr.Bytes {
+		return nil, errors.New("keystore: malformed supervisor secret")
+	}
+	pub, _ := hex.DecodeString(hdr.Public)
+	pk := new(twistededwards.PointAffine)
+	if err = pk.Unmarshal(pub); err != nil {
+		return nil, fmt.Errorf("keystore: invalid public key: %w", err)
+	}
+
+	sk := SecretScalar{new(fr.Element)}
+	if err = sk.e.SetBytesCanonical(pt); err != nil || ctLess(sk.e.Bits(), jubjubOrder) == 0 {
+		sk.Destroy()
+		return nil, errors.New("keystore: malformed supervisor secret")
+	}
+	if !pk.Equal(jubjubMul(crs.gj, sk.element())) {
+		sk.Destroy()
+		return nil, errors.New("keystore: secret key does not match public key")
+	}
+	return &Key{sk, pk}, nil
+}
+
+// EncryptUser seals the user opening (x, k). The identifier is derived from C.
+func EncryptUser(pv *PKEETVPG, password []byte, params KDFParams) ([]byte, error) {
+	C := pv.C.Marshal()
+	x := pv.x.element().Bytes()
+	k := pv.k.element().Bytes()
+	pt := append(x[:], k[:]...)
+	defer wipeBytes(x[:])
+	defer wipeBytes(k[:])
+	defer wipeBytes(pt)
+	return sealKeystore(KeystoreUser, C, pt, password, params)
+}
+
+// DecryptUser opens a user keystore and checks that (x, k) opens the stored C
+func DecryptUser(crs *PoKCRS, data, password []byte) (*PKEETVPG, error) {
+	hdr, pt, err := openKeystore(KeystoreUser, data, password)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(pt)
+	if len(pt) != 2*fr.Bytes {
+		return nil, errors.New("keystore: malformed user secret")
+	}
+	pub, _ := hex.DecodeString(hdr.Public)
+	C := new(bls12381.G1Affine)
+	if err = C.Unmarshal(pub); err != nil {
+		return nil, fmt.Errorf("keystore: invalid commitment: %w", err)
+	}
+
+	x := SecretScalar{new(fr.Element)}
+	k := SecretScalar{new(fr.Element)}
+	pv := &PKEETVPG{x, k, C}
+	if x.e.SetBytesCanonical(pt[:fr.Bytes]) != nil || k.e.SetBytesCanonical(pt[fr.Bytes:]) != nil {
+		pv.Destroy()
+		return nil, errors.New("keystore: malformed user secret")
+	}
+	C_ := new(bls12381.G1Affine).Add(g1Mul(crs.g, x.element()), g1Mul(crs.h, k.element()))
+	if !C.Equal(C_) {
+		pv.Destroy()
+		return nil, errors.New("keystore: opening does not match commitment")
+	}
+	return pv, nil
+}
+
+// KeystoreID returns the type and identifier of a keystore without decrypting it
+func KeystoreID(data []byte) (string, string, error) {
+	var f keystoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", "", fmt.Errorf("keystore: %w", err)
+	}
+	return f.Type, f.ID, nil
+}
+
+// WriteKeystore writes a keystore to path with owner-only permissions. The data
+// goes to a temporary file first, so an existing keystore is never truncated.
+func WriteKeystore(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0o600); err == nil {
+		if _, err = tmp.Write(data); err == nil {
+			err = tmp.Sync()
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func sealKeystore(typ string, public, pt, password []byte, params KDFParams) ([]byte, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	hdr := keystoreHeader{
+		Version: keystoreVersion,
+		Type:    typ,
+		ID:      KeyID(typ, public),
+		Public:  hex.EncodeToString(public),
+		KDF:     keystoreKDFHeader{keystoreKDF, hex.EncodeToString(salt), params},
+		Cipher:  keystoreCipherHeader{keystoreCipher, hex.EncodeToString(nonce)},
+	}
+	aad, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := keystoreAEAD(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	ct := aead.Seal(nil, nonce, pt, aad)
+	return json.MarshalIndent(keystoreFile{hdr, hex.EncodeToString(ct)}, "", "  ")
+}
+
+func openKeystore(typ string, data, password []byte) (*keystoreHeader, []byte, error) {
+	var f keystoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, nil, fmt.Errorf("keystore: %w", err)
+	}
+	hdr := f.keystoreHeader
+	if hdr.Version != keystoreVersion {
+		return nil, nil, fmt.Errorf("keystore: unsupported version %d", hdr.Version)
+	}
+	if hdr.Type != typ {
+		return nil, nil, fmt.Errorf("keystore: expected a %s keystore, got %q", typ, hdr.Type)
+	}
+	if hdr.KDF.Name != keystoreKDF || hdr.Cipher.Name != keystoreCipher {
+		return nil, nil, errors.New("keystore: unsupported kdf or cipher")
+	}
+	if err := hdr.KDF.KDFParams.check(); err != nil {
+		return nil, nil, err
+	}
+	public, err := hex.DecodeString(hdr.Public)
+	if err != nil || KeyID(typ, public) != hdr.ID {
+		return nil, nil, errors.New("keystore: key identifier does not match public key")
+	}
+	salt, err := hex.DecodeString(hdr.KDF.Salt)
+	if err != nil {
+		return nil, nil, errors.New("keystore: malformed salt")
+	}
+	nonce, err := hex.DecodeString(hdr.Cipher.Nonce)
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, nil, errors.New("keystore: malformed nonce")
+	}
+	ct, err := hex.DecodeString(f.Ciphertext)
+	if err != nil {
+		return nil, nil, errors.New("keystore: malformed ciphertext")
+	}
+	aad, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := keystoreAEAD(password, salt, hdr.KDF.KDFParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	pt, err := aead.Open(nil, nonce, ct, aad)
+	if err != nil {
+		return nil, nil, errors.New("keystore: wrong password or corrupted keystore")
+	}
+	return &hdr, pt, nil
+}
+
+func keystoreAEAD(password, salt []byte, params KDFParams) (cipher.AEAD, error) {
+	key := argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+	defer wipeBytes(key)
+	return chacha20poly1305.NewX(key)
+}
+
+func (p KDFParams) check() error {
+	if p.Time == 0 || p.Threads == 0 || p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory {
+		return errors.New("keystore: invalid kdf parameters")
+	}
+	return nil
+}
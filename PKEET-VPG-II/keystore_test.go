@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKDFParams keeps argon2id cheap in tests
+var testKDFParams = KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+
+func TestKeystoreSupervisor(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, err := RandSecretJubjub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+	password := []byte("correct horse battery staple")
+
+	data, err := EncryptKey(key, password, testKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(data), sk.element().Text(16))
+
+	typ, id, err := KeystoreID(data)
+	assert.Nil(t, err)
+	assert.Equal(t, KeystoreSupervisor, typ)
+	assert.Equal(t, KeyID(KeystoreSupervisor, key.pk.Marshal()), id)
+
+	path := filepath.Join(t.TempDir(), "supervisor.json")
+	if err = WriteKeystore(path, data); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key_, err := DecryptKey(crs, data, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, key.pk.Equal(key_.pk))
+	assert.True(t, key.sk.element().Equal(key_.sk.element()))
+
+	// the loaded key decrypts
+	x, _ := randJubjubScalar()
+	v, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	ct, _ := Enc(crs, key_.pk, 0, m, v)
+	m_, err := Dec(crs, ct, key_)
+	assert.Nil(t, err)
+	assert.Equal(t, m, m_)
+
+	_, err = DecryptKey(crs, data, []byte("wrong"))
+	assert.NotNil(t, err)
+	_, err = DecryptUser(NewPoKCRS(getRandomG1(), getRandomG1(), getRandomG2()), data, password)
+	assert.NotNil(t, err)
+}
+
+func TestKeystoreUser(t *testing.T) {
+	_, _, g1, g2 := bls12381.Generators()
+	crs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, x.element()), g1Mul(crs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+	password := []byte("hunter2")
+
+	data, err := EncryptUser(user, password, testKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user_, err := DecryptUser(crs, data, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, user.C.Equal(user_.C))
+	assert.True(t, user.x.element().Equal(user_.x.element()))
+	assert.True(t, user.k.element().Equal(user_.k.element()))
+
+	// the opening is checked against C under the given CRS
+	_, err = DecryptUser(NewPoKCRS(&g1, getRandomG1(), &g2), data, password)
+	assert.NotNil(t, err)
+}
+
+func TestKeystoreTamper(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+	password := []byte("pw")
+	data, err := EncryptKey(key, password, testKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(f func(*keystoreFile)) []byte {
+		var ks keystoreFile
+		if err := json.Unmarshal(data, &ks); err != nil {
+			t.Fatal(err)
+		}
+		f(&ks)
+		out, _ := json.Marshal(ks)
+		return out
+	}
+
+	other := jubjubMul(crs.gj, sk.element())
+	other.Add(other, crs.gj)
+	cases := map[string][]byte{
+		"version": tamper(func(ks *keystoreFile) { ks.Version = 2 }),
+		"id":      tamper(func(ks *keystoreFile) { ks.ID = KeyID(KeystoreSupervisor, crs.gj.Marshal()) }),
+		"public": tamper(func(ks *keystoreFile) {
+			ks.Public = hex.EncodeToString(other.Marshal())
+			ks.ID = KeyID(KeystoreSupervisor, other.Marshal())
+		}),
+		"kdf":    tamper(func(ks *keystoreFile) { ks.KDF.Time++ }),
+		"memory": tamper(func(ks *keystoreFile) { ks.KDF.Memory = maxKDFMemory + 1 }),
+		"type":   tamper(func(ks *keystoreFile) { ks.Type = KeystoreUser }),
+	}
+	for name, c := range cases {
+		_, err := DecryptKey(crs, c, password)
+		assert.NotNil(t, err, name)
+	}
+
+	_, err = EncryptKey(key, password, KDFParams{})
+	assert.NotNil(t, err)
+}
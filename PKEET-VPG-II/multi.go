@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	twistededwards2 "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	twistededwards1 "github.com/consensys/gnark/std/algebra/native/twistededwards"
+)
+
+// MultiPKECricuit is PKECricuit for several supervisors: the same m = gj^x is
+// encrypted once per entry of Cts, each with its own nonce. m and B are
+// computed once, so every extra recipient costs one encryption.
+type MultiPKECricuit struct {
+	X  frontend.Variable
+	S  frontend.Variable
+	MX frontend.Variable
+	MY frontend.Variable
+
+	HX frontend.Variable `gnark:",public"`
+	HY frontend.Variable `gnark:",public"`
+
+	Cts []PKECtVars
+
+	BX frontend.Variable `gnark:",public"`
+	BY frontend.Variable `gnark:",public"`
+}
+
+// NewMultiPKECricuit returns a circuit for n recipients, ready to compile
+func NewMultiPKECricuit(n int) *MultiPKECricuit {
+	return &MultiPKECricuit{Cts: make([]PKECtVars, n)}
+}
+
+// Layout of the public witness of MultiPKECricuit: HX, HY, then the inputs of
+// each ciphertext in PKECtVars order, then BX, BY
+const (
+	mpubCts    = 2
+	ctPubPKX   = 0
+	ctPubUX    = 2
+	ctPubW     = 6
+	ctPubKID   = 9
+	ctPubCount = 10
+)
+
+func (circuit *MultiPKECricuit) Define(api frontend.API) error {
+	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
+	if err != nil {
+		panic(err)
+	}
+	base := twistededwards1.Point{
+		X: curve.Params().Base[0],
+		Y: curve.Params().Base[1],
+	}
+	H := twistededwards1.Point{
+		X: circuit.HX,
+		Y: circuit.HY,
+	}
+
+	m_ := curve.ScalarMul(base, circuit.X)
+	api.AssertIsEqual(m_.X, circuit.MX)
+	api.AssertIsEqual(m_.Y, circuit.MY)
+
+	for i := range circuit.Cts {
+		if err = defineCt(api, curve, base, m_, circuit.MX, circuit.MY, &circuit.Cts[i]); err != nil {
+			return err
+		}
+	}
+
+	ind2 := curve.ScalarMul(H, circuit.S)
+	B_ := curve.Add(m_, ind2)
+	api.AssertIsEqual(B_.X, circuit.BX)
+	api.AssertIsEqual(B_.Y, circuit.BY)
+
+	return nil
+}
+
+// Recipient is a supervisor key and the epoch it belongs to
+type Recipient struct {
+	PK    *twistededwards.PointAffine
+	Epoch uint32
+}
+
+type PKEETVPGMultiProof struct {
+	Recipients []Recipient
+	B          *twistededwards.PointAffine
+	cts        []*Ciphertext
+
+	pubWit     witness.Witness
+	snarkProof groth16.Proof
+
+	pkp *PoKProof
+	cgp []*CGProof
+}
+
+// ProofMulti encrypts m = gj^x to every recipient and proves all ciphertexts in
+// one SNARK. crs must be set up for MultiPKECricuit with len(recipients)
+// ciphertexts.
+func (pv *PKEETVPG) ProofMulti(crs *CRS, recipients []Recipient, H *bls12381.G1Affine) (*PKEETVPGMultiProof, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	// ephemeral nonces, wiped once the proof is done
+	vs := make([]fr.Element, len(recipients))
+	var s fr.Element
+	defer func() {
+		for i := range vs {
+			wipeElement(&vs[i])
+		}
+	}()
+	defer wipeElement(&s)
+
+	// 0. Encrypt
+	m := jubjubMul(crs.gj, pv.x.element())
+	cts := make([]*Ciphertext, len(recipients))
+	assignment := NewMultiPKECricuit(len(recipients))
+	for i, rc := range recipients {
+		r, err := randJubjubScalar()
+		if err != nil {
+			return nil, err
+		}
+		vs[i].Set(r)
+		wipeElement(r)
+		cts[i], err = Enc(crs.PKECRS, rc.PK, rc.Epoch, m, &vs[i])
+		if err != nil {
+			return nil, err
+		}
+		assignment.Cts[i] = PKECtVars{
+			V:   &vs[i],
+			PKX: rc.PK.X,
+			PKY: rc.PK.Y,
+			UX:  cts[i].U.X,
+			UY:  cts[i].U.Y,
+			VX:  cts[i].V.X,
+			VY:  cts[i].V.Y,
+			W:   cts[i].W[0],
+			W1:  cts[i].W[1],
+			W2:  cts[i].W[2],
+			KID: rc.Epoch,
+		}
+	}
+
+	// 1. zkSNARKs
+	r, err := randJubjubScalar()
+	if err != nil {
+		return nil, err
+	}
+	s.Set(r)
+	wipeElement(r)
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, &s))
+	assignment.X = pv.x.element()
+	assignment.S = &s
+	assignment.MX, assignment.MY = m.X, m.Y
+	assignment.HX, assignment.HY = crs.hj.X, crs.hj.Y
+	assignment.BX, assignment.BY = B.X, B.Y
+
+	secretWitness, err := frontend.NewWitness(assignment, ecc.BLS12_381.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	publicWitness, err := secretWitness.Public()
+	if err != nil {
+		return nil, err
+	}
+	snarkProof, err := groth16.Prove(crs.ccs, crs.spk, secretWitness)
+	wipeWitness(secretWitness)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. PoK and 3. CGPoK
+	pkp, cgp, err := pv.proveOpening(crs, &s, H)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKEETVPGMultiProof{
+		Recipients: append([]Recipient(nil), recipients...),
+		B:          B,
+		cts:        cts,
+		pubWit:     publicWitness,
+		snarkProof: snarkProof,
+		pkp:        pkp,
+		cgp:        cgp,
+	}, nil
+}
+
+// VerifyMulti checks a multi-recipient proof, including that the ciphertexts
+// go to the listed recipients
+func VerifyMulti(crs *CRS, context []byte, pvp *PKEETVPGMultiProof) error {
+	if pvp == nil || pvp.B == nil || pvp.pubWit == nil || pvp.snarkProof == nil || pvp.pkp == nil {
+		return errors.New("malformed proof")
+	}
+	for i, rc := range pvp.Recipients {
+		if rc.PK == nil {
+			return fmt.Errorf("recipient %d has no key", i)
+		}
+	}
+	// 1. zkSNARKs verify
+	err := groth16.Verify(pvp.snarkProof, crs.svk, pvp.pubWit)
+	if err != nil {
+		return errors.New("snark verification failed: " + err.Error())
+	}
+	n := len(pvp.Recipients)
+	pub, ok := pvp.pubWit.Vector().(fr.Vector)
+	if !ok || n == 0 || len(pvp.cts) != n || len(pub) != mpubCts+n*ctPubCount+2 {
+		return errors.New("malformed public witness")
+	}
+	if !crs.hj.X.Equal(&pub[0]) || !crs.hj.Y.Equal(&pub[1]) {
+		return errors.New("hj does not match the snark statement")
+	}
+	for i, rc := range pvp.Recipients {
+		off := mpubCts + i*ctPubCount
+		if !rc.PK.X.Equal(&pub[off+ctPubPKX]) || !rc.PK.Y.Equal(&pub[off+ctPubPKX+1]) {
+			return fmt.Errorf("recipient %d does not match the snark statement", i)
+		}
+		if err = checkCtInputs(pvp.cts[i], pub, off+ctPubUX, off+ctPubW, off+ctPubKID); err != nil {
+			return fmt.Errorf("recipient %d: %w", i, err)
+		}
+		if err = checkNoTag(pvp.cts[i]); err != nil {
+			return fmt.Errorf("recipient %d: %w", i, err)
+		}
+		if pvp.cts[i].Epoch != rc.Epoch {
+			return fmt.Errorf("recipient %d: key epoch does not match the snark statement", i)
+		}
+	}
+	off := mpubCts + n*ctPubCount
+	if !pvp.B.X.Equal(&pub[off]) || !pvp.B.Y.Equal(&pub[off+1]) {
+		return errors.New("B does not match the snark statement")
+	}
+
+	return verifyOpening(crs, context, pvp.B, pvp.pkp, pvp.cgp)
+}
+
+// Ciphertexts returns the ciphertext of each recipient, in order
+func (pvp *PKEETVPGMultiProof) Ciphertexts() []*Ciphertext {
+	return pvp.cts
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMultiCircuitLinear(t *testing.T) {
+	var pCircuit PKECricuit
+	single, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &pCircuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts []int
+	for n := 1; n <= 3; n++ {
+		ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, NewMultiPKECricuit(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, ccs.GetNbConstraints())
+		assert.Equal(t, mpubCts+n*ctPubCount+2, ccs.GetNbPublicVariables()-1)
+	}
+	// PKECricuit also binds its public Y, with two more constraints
+	assert.Equal(t, single.GetNbConstraints()-2, counts[0])
+	assert.Equal(t, counts[1]-counts[0], counts[2]-counts[1])
+}
+
+func TestPKEETVPGMulti(t *testing.T) {
+	// 1. Setup for two supervisors
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, NewMultiPKECricuit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	pkeCrs := &PKECRS{&curve.Base, getRandomG()}
+	_, _, g1, g2 := bls12381.Generators()
+	pokCrs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH)
+
+	var keys []*Key
+	var recipients []Recipient
+	for i := 0; i < 2; i++ {
+		sk, _ := RandSecretJubjub()
+		key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+		keys = append(keys, key)
+		recipients = append(recipients, Recipient{key.pk, uint32(10 + i)})
+	}
+
+	// 2. user
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+
+	// 3. prove and verify
+	pvp, err := user.ProofMulti(crs, recipients, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, VerifyMulti(crs, ctxH, pvp))
+
+	// 4. every supervisor opens its own copy
+	m := jubjubMul(pkeCrs.gj, x.element())
+	for i, ct := range pvp.Ciphertexts() {
+		assert.Equal(t, recipients[i].Epoch, ct.Epoch)
+		m_, err := Dec(pkeCrs, ct, keys[i])
+		assert.Nil(t, err)
+		assert.True(t, m.Equal(m_))
+
+		// the public witness does not hold Y, which opens the ciphertext
+		Y := jubjubMul(ct.U, keys[i].sk.element())
+		for _, e := range pvp.pubWit.Vector().(fr.Vector) {
+			assert.False(t, e.Equal(&Y.X) || e.Equal(&Y.Y))
+		}
+	}
+
+	// the recipients are part of the statement
+	pvp.Recipients[0], pvp.Recipients[1] = pvp.Recipients[1], pvp.Recipients[0]
+	assert.NotNil(t, VerifyMulti(crs, ctxH, pvp))
+	pvp.Recipients[0], pvp.Recipients[1] = pvp.Recipients[1], pvp.Recipients[0]
+	pvp.Recipients[1].Epoch++
+	assert.NotNil(t, VerifyMulti(crs, ctxH, pvp))
+	pvp.Recipients[1].Epoch--
+	pvp.cts[0], pvp.cts[1] = pvp.cts[1], pvp.cts[0]
+	assert.NotNil(t, VerifyMulti(crs, ctxH, pvp))
+	pvp.cts[0], pvp.cts[1] = pvp.cts[1], pvp.cts[0]
+	assert.Nil(t, VerifyMulti(crs, ctxH, pvp))
+
+	// a proof made with a Pedersen base of the prover's choice is rejected
+	rogue := &CRS{ccs, spk, svk, &PKECRS{pkeCrs.gj, getRandomG()}, pokCrs}
+	forged, err := user.ProofMulti(rogue, recipients, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorContains(t, VerifyMulti(crs, ctxH, forged), "hj")
+
+	// a malformed proof is an error, not a panic
+	assert.NotNil(t, VerifyMulti(crs, ctxH, &PKEETVPGMultiProof{Recipients: recipients}))
+	saved := pvp.cts[1]
+	pvp.cts[1] = nil
+	assert.NotNil(t, VerifyMulti(crs, ctxH, pvp))
+	pvp.cts[1] = saved
+	pvp.Recipients[1].PK = nil
+	assert.NotNil(t, VerifyMulti(crs, ctxH, pvp))
+	pvp.Recipients[1].PK = keys[1].pk
+
+	// the circuit is sized for two recipients
+	_, err = user.ProofMulti(crs, recipients[:1], H)
+	assert.NotNil(t, err)
+}
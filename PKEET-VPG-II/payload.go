@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+)
+
+// Attribute payloads are escrowed next to m with a KEM/DEM on the same
+// Y = pk^v. The KEM key is k = MiMC(Y, U, KID, payloadTag), the DEM is the
+// field stream cipher c_i = a_i + MiMC(k, i) for i = 1..n, and the tag
+// T = MiMC(k, 0, c_1..c_n) lets the supervisor detect a tampered payload.
+// PayloadPKECricuit proves the same relations, with c_i and T as public inputs.
+// It builds on VEPKECricuit, which keeps Y private, since Y opens the payload.
+
+// payloadTag separates the KEM key from the W masks
+const payloadTag = 4
+
+// PayloadCiphertext is the DEM part of a ciphertext
+type PayloadCiphertext struct {
+	C []fr.Element
+	T fr.Element
+}
+
+// EncPayload is Enc with attribute payload escrowed to the same key
+func EncPayload(crs *PKECRS, pk *twistededwards.PointAffine, epoch uint32, m *twistededwards.PointAffine, payload []fr.Element, v *fr.Element) (*Ciphertext, error) {
+	ct, err := Enc(crs, pk, epoch, m, v)
+	if err != nil {
+		return nil, err
+	}
+	ct.Payload = sealPayload(ct, jubjubMul(pk, v), payload)
+	return ct, nil
+}
+
+// DecPayload opens ct and its attribute payload with the supervisor key behind d
+func DecPayload(crs *PKECRS, ct *Ciphertext, d Decrypter) (*twistededwards.PointAffine, []fr.Element, error) {
+	if ct.Payload == nil {
+		return nil, nil, errors.New("ciphertext has no payload")
+	}
+	Y, err := d.SharedPoint(ct.U)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := decWithY(crs, ct, Y)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := openPayload(ct, Y)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, payload, nil
+}
+
+func payloadKey(ct *Ciphertext, Y *twistededwards.PointAffine) fr.Element {
+	var kid, tag fr.Element
+	kid.SetUint64(uint64(ct.Epoch))
+	tag.SetUint64(payloadTag)
+	return mimcElements(&Y.X, &Y.Y, &ct.U.X, &ct.U.Y, &kid, &tag)
+}
+
+func payloadStream(k *fr.Element, i int) fr.Element {
+	var idx fr.Element
+	idx.SetUint64(uint64(i))
+	return mimcElements(k, &idx)
+}
+
+func payloadTagOf(k *fr.Element, c []fr.Element) fr.Element {
+	hFunc := hash.MIMC_BLS12_381.New()
+	kb := k.Bytes()
+	var zero [fr.Bytes]byte
+	hFunc.Write(kb[:])
+	hFunc.Write(zero[:])
+	for i := range c {
+		b := c[i].Bytes()
+		hFunc.Write(b[:])
+	}
+	var res fr.Element
+	res.SetBytes(hFunc.Sum(nil))
+	return res
+}
+
+func sealPayload(ct *Ciphertext, Y *twistededwards.PointAffine, payload []fr.Element) *PayloadCiphertext {
+	k := payloadKey(ct, Y)
+	defer wipeElement(&k)
+	pc := &PayloadCiphertext{C: make([]fr.Element, len(payload))}
+	for i := range payload {
+		s := payloadStream(&k, i+1)
+		pc.C[i].Add(&payload[i], &s)
+		wipeElement(&s)
+	}
+	pc.T = payloadTagOf(&k, pc.C)
+	return pc
+}
+
+func openPayload(ct *Ciphertext, Y *twistededwards.PointAffine) ([]fr.Element, error) {
+	k := payloadKey(ct, Y)
+	defer wipeElement(&k)
+	T := payloadTagOf(&k, ct.Payload.C)
+	if !T.Equal(&ct.Payload.T) {
+		return nil, errors.New("payload decryption failed")
+	}
+	payload := make([]fr.Element, len(ct.Payload.C))
+	for i := range payload {
+		s := payloadStream(&k, i+1)
+		payload[i].Sub(&ct.Payload.C[i], &s)
+		wipeElement(&s)
+	}
+	return payload, nil
+}
+
+// PayloadPKECricuit is VEPKECricuit plus an attribute payload of len(A) field
+// elements encrypted under the key derived from Y. Y is not an input, so the
+// public witness does not open the payload.
+type PayloadPKECricuit struct {
+	VEPKECricuit
+	A []frontend.Variable
+
+	C []frontend.Variable `gnark:",public"`
+	T frontend.Variable   `gnark:",public"`
+}
+
+// NewPayloadPKECricuit returns a circuit for n payload elements, ready to compile
+func NewPayloadPKECricuit(n int) *PayloadPKECricuit {
+	return &PayloadPKECricuit{A: make([]frontend.Variable, n), C: make([]frontend.Variable, n)}
+}
+
+func (circuit *PayloadPKECricuit) Define(api frontend.API) error {
+	_Y, err := circuit.VEPKECricuit.define(api)
+	if err != nil {
+		return err
+	}
+
+	// the KEM key comes from the private Y = pk^v
+	miMC, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	miMC.Write(_Y.X, _Y.Y, circuit.UX, circuit.UY, circuit.KID, payloadTag)
+	k := miMC.Sum()
+
+	for i := range circuit.A {
+		miMC.Reset()
+		miMC.Write(k, i+1)
+		api.AssertIsEqual(circuit.C[i], api.Add(circuit.A[i], miMC.Sum()))
+	}
+
+	miMC.Reset()
+	miMC.Write(k, 0)
+	miMC.Write(circuit.C...)
+	api.AssertIsEqual(circuit.T, miMC.Sum())
+
+	return nil
+}
+
+// payloadAssign seals payload into the ciphertext and assigns it in
+// PayloadPKECricuit
+func payloadAssign(payload []fr.Element) encAssign {
+	return func(base *PKECricuit, ct *Ciphertext, _, Y *twistededwards.PointAffine, _ *fr.Element) frontend.Circuit {
+		ct.Payload = sealPayload(ct, Y, payload)
+		assignment := NewPayloadPKECricuit(len(payload))
+		assignment.VEPKECricuit = veAssignment(base)
+		for i := range payload {
+			assignment.A[i] = payload[i]
+			assignment.C[i] = ct.Payload.C[i]
+		}
+		assignment.T = ct.Payload.T
+		return assignment
+	}
+}
+
+// checkPayloadInputs checks the payload part of ct against the public inputs
+// after those of VEPKECricuit
+func checkPayloadInputs(ct *Ciphertext, pub fr.Vector) error {
+	if ct.Payload == nil {
+		if len(pub) != 0 {
+			return errors.New("payload does not match the snark statement")
+		}
+		return nil
+	}
+	if len(pub) != len(ct.Payload.C)+1 {
+		return errors.New("payload does not match the snark statement")
+	}
+	for i := range ct.Payload.C {
+		if !ct.Payload.C[i].Equal(&pub[i]) {
+			return errors.New("payload does not match the snark statement")
+		}
+	}
+	if !ct.Payload.T.Equal(&pub[len(pub)-1]) {
+		return errors.New("payload does not match the snark statement")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncPayload(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+
+	payload := make([]fr.Element, 3)
+	for i := range payload {
+		payload[i].SetRandom()
+	}
+	x, _ := randJubjubScalar()
+	v, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	ct, err := EncPayload(crs, key.pk, 1, m, payload, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m_, payload_, err := DecPayload(crs, ct, key)
+	assert.Nil(t, err)
+	assert.True(t, m.Equal(m_))
+	assert.Equal(t, payload, payload_)
+
+	// the payload is bound to the key and to its own ciphertext
+	sk2, _ := RandSecretJubjub()
+	_, _, err = DecPayload(crs, ct, &Key{sk2, jubjubMul(crs.gj, sk2.element())})
+	assert.NotNil(t, err)
+	var one fr.Element
+	one.SetOne()
+	ct.Payload.C[1].Add(&ct.Payload.C[1], &one)
+	_, _, err = DecPayload(crs, ct, key)
+	assert.NotNil(t, err)
+
+	plain, _ := Enc(crs, key.pk, 1, m, v)
+	_, _, err = DecPayload(crs, plain, key)
+	assert.NotNil(t, err)
+}
+
+func TestPKEETVPGPayload(t *testing.T) {
+	// 1. Setup for payloads of 2 elements
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, NewPayloadPKECricuit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	pkeCrs := &PKECRS{&curve.Base, getRandomG()}
+	_, _, g1, g2 := bls12381.Generators()
+	pokCrs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH)
+
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+
+	// 2. user
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+
+	payload := make([]fr.Element, 2)
+	payload[0].SetUint64(1990)
+	payload[1].SetUint64(276)
+	pvp, err := user.ProofPayload(crs, key.pk, 2, payload, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, Verify(crs, PublicKeyring{2: key.pk}, ctxH, pvp))
+
+	// 3. supervisor
+	m, payload_, err := DecPayload(pkeCrs, pvp.Ciphertext(), key)
+	assert.Nil(t, err)
+	assert.True(t, jubjubMul(pkeCrs.gj, x.element()).Equal(m))
+	assert.Equal(t, payload, payload_)
+
+	// the public witness does not hold Y, so it does not open the payload
+	Y := jubjubMul(pvp.Ciphertext().U, sk.element())
+	pub, err := pvp.publicInputs(vpubKID)
+	assert.Nil(t, err)
+	for i := range pub {
+		assert.False(t, pub[i].Equal(&Y.X) || pub[i].Equal(&Y.Y))
+		if i > 0 {
+			_, err = openPayload(pvp.Ciphertext(), &twistededwards.PointAffine{X: pub[i-1], Y: pub[i]})
+			assert.NotNil(t, err)
+		}
+	}
+	_, err = openPayload(pvp.Ciphertext(), Y)
+	assert.Nil(t, err)
+
+	// the proof binds the payload ciphertext
+	ct := pvp.Ciphertext()
+	saved := ct.Payload
+	ct.Payload = &PayloadCiphertext{C: append([]fr.Element(nil), saved.C...), T: saved.T}
+	ct.Payload.C[0].SetUint64(7)
+	assert.NotNil(t, Verify(crs, PublicKeyring{2: key.pk}, ctxH, pvp))
+	ct.Payload = nil
+	assert.NotNil(t, Verify(crs, PublicKeyring{2: key.pk}, ctxH, pvp))
+	ct.Payload = saved
+	assert.Nil(t, Verify(crs, PublicKeyring{2: key.pk}, ctxH, pvp))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"errors"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"github.com/consensys/gnark-crypto/hash"
 	"math/big"
@@ -12,21 +14,29 @@ type PKECRS struct {
 }
 
 type Key struct {
-	sk *big.Int
+	sk SecretScalar
 	pk *twistededwards.PointAffine
 }
 
+// Ciphertext is made under the supervisor key of Epoch. The epoch is hashed
+// into the W masks, so a ciphertext relabelled to another epoch does not decrypt.
 type Ciphertext struct {
-	U, V *twistededwards.PointAffine
-	W    [3]big.Int
+	Epoch uint32
+	U, V  *twistededwards.PointAffine
+	W     [3]big.Int
+
+	// Payload is the encrypted attribute payload, if any
+	Payload *PayloadCiphertext
+	// Tag is the equality-test tag, if any
+	Tag *EqTag
 }
 
-func Enc(crs *PKECRS, pk, m *twistededwards.PointAffine, v *big.Int) (*Ciphertext, error) {
+func Enc(crs *PKECRS, pk *twistededwards.PointAffine, epoch uint32, m *twistededwards.PointAffine, v *fr.Element) (*Ciphertext, error) {
 	curve := twistededwards.GetEdwardsCurve()
 
-	U := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, v)
-	V := new(twistededwards.PointAffine).ScalarMultiplication(m, v)
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(pk, v)
+	U := jubjubMul(crs.gj, v)
+	V := jubjubMul(m, v)
+	Y := jubjubMul(pk, v)
 
 	_ux := U.X.Bytes()
 	_uy := U.Y.Bytes()
@@ -39,6 +49,8 @@ func Enc(crs *PKECRS, pk, m *twistededwards.PointAffine, v *big.Int) (*Ciphertex
 	arr = append(arr, _vy[:]...)
 	arr = append(arr, _yx[:]...)
 	arr = append(arr, _yy[:]...)
+	_e := epochBytes(epoch)
+	arr = append(arr, _e[:]...)
 
 	One := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, big.NewInt(1))
 	Two := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, big.NewInt(2))
@@ -69,7 +81,8 @@ func Enc(crs *PKECRS, pk, m *twistededwards.PointAffine, v *big.Int) (*Ciphertex
 	hFunc.Write(arr)
 	ho3 := hFunc.Sum(nil)
 
-	vByte := BigIntToFixed32Bytes(v)
+	vByte := v.Bytes()
+	defer wipeBytes(vByte[:])
 	mxByte := m.X.Bytes()
 	myByte := m.Y.Bytes()
 	var resXOR, resXOR1, resXOR2 [32]byte
@@ -82,12 +95,31 @@ func Enc(crs *PKECRS, pk, m *twistededwards.PointAffine, v *big.Int) (*Ciphertex
 	res1 := new(big.Int).SetBytes(resXOR1[:])
 	res2 := new(big.Int).SetBytes(resXOR2[:])
 
-	return &Ciphertext{U, V, [3]big.Int{*res, *res1, *res2}}, nil
+	return &Ciphertext{Epoch: epoch, U: U, V: V, W: [3]big.Int{*res, *res1, *res2}}, nil
 }
 
-func Dec(crs *PKECRS, ct *Ciphertext, sk *big.Int) (*twistededwards.PointAffine, error) {
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(ct.U, sk)
+// Dec opens ct with the supervisor key behind d, which is either an in-memory
+// Key or a Decrypter running in another process
+func Dec(crs *PKECRS, ct *Ciphertext, d Decrypter) (*twistededwards.PointAffine, error) {
+	Y, err := d.SharedPoint(ct.U)
+	if err != nil {
+		return new(twistededwards.PointAffine), err
+	}
+	return decWithY(crs, ct, Y)
+}
 
+// decWithY finishes decryption once Y = U^sk is known
+func decWithY(crs *PKECRS, ct *Ciphertext, Y *twistededwards.PointAffine) (*twistededwards.PointAffine, error) {
+	m, v, err := openWithY(crs, ct, Y)
+	if v != nil {
+		wipeElement(v)
+	}
+	return m, err
+}
+
+// openWithY recovers m and the encryption nonce v from Y = U^sk. The caller
+// wipes v.
+func openWithY(crs *PKECRS, ct *Ciphertext, Y *twistededwards.PointAffine) (*twistededwards.PointAffine, *fr.Element, error) {
 	_ux := ct.U.X.Bytes()
 	_uy := ct.U.Y.Bytes()
 	_vx := ct.V.X.Bytes()
@@ -99,6 +131,8 @@ func Dec(crs *PKECRS, ct *Ciphertext, sk *big.Int) (*twistededwards.PointAffine,
 	arr = append(arr, _vy[:]...)
 	arr = append(arr, _yx[:]...)
 	arr = append(arr, _yy[:]...)
+	_e := epochBytes(ct.Epoch)
+	arr = append(arr, _e[:]...)
 
 	One := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, big.NewInt(1))
 	Two := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, big.NewInt(2))
@@ -134,15 +168,24 @@ func Dec(crs *PKECRS, ct *Ciphertext, sk *big.Int) (*twistededwards.PointAffine,
 		myByte[i] = ho3[i] ^ WByte2[i]
 	}
 
-	v := new(big.Int).SetBytes(vByte[:])
+	v := new(fr.Element).SetBytes(vByte[:])
+	wipeBytes(vByte[:])
 	var m twistededwards.PointAffine
 	m.X.SetBytes(mxByte[:])
 	m.Y.SetBytes(myByte[:])
 
-	if ct.U.Equal(new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, v)) && ct.V.Equal(new(twistededwards.PointAffine).ScalarMultiplication(&m, v)) {
-		return &m, nil
+	if ct.U.Equal(jubjubMul(crs.gj, v)) && ct.V.Equal(jubjubMul(&m, v)) {
+		return &m, v, nil
 	}
-	return new(twistededwards.PointAffine), errors.New("decryption failed")
+	wipeElement(v)
+	return new(twistededwards.PointAffine), nil, errors.New("decryption failed")
+}
+
+// epochBytes encodes the epoch as one 32-byte MiMC block, as the circuit sees KID
+func epochBytes(epoch uint32) [32]byte {
+	var b [32]byte
+	binary.BigEndian.PutUint32(b[28:], epoch)
+	return b
 }
 
 func BigIntToFixed32Bytes(n *big.Int) [32]byte {
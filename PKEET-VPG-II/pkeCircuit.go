@@ -32,8 +32,31 @@ type PKECricuit struct {
 
 	BX frontend.Variable `gnark:",public"`
 	BY frontend.Variable `gnark:",public"`
+
+	KID frontend.Variable `gnark:",public"`
 }
 
+// Positions of the public inputs of PKECricuit in its public witness, which
+// follows the field order
+const (
+	pubHX = iota
+	pubHY
+	pubPKX
+	pubPKY
+	pubUX
+	pubUY
+	pubVX
+	pubVY
+	pubYX
+	pubYY
+	pubW
+	pubW1
+	pubW2
+	pubBX
+	pubBY
+	pubKID
+)
+
 func (circuit *PKECricuit) Define(api frontend.API) error {
 	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
 	if err != nil {
@@ -43,36 +66,92 @@ func (circuit *PKECricuit) Define(api frontend.API) error {
 		X: curve.Params().Base[0],
 		Y: curve.Params().Base[1],
 	}
-	PK := twistededwards1.Point{
-		X: circuit.PKX,
-		Y: circuit.PKY,
-	}
 	H := twistededwards1.Point{
 		X: circuit.HX,
 		Y: circuit.HY,
 	}
 
 	m_ := curve.ScalarMul(base, circuit.X)
-	_U := curve.ScalarMul(base, circuit.V)
-	_V := curve.ScalarMul(m_, circuit.V)
-	_Y := curve.ScalarMul(PK, circuit.V)
-
 	api.AssertIsEqual(m_.X, circuit.MX)
 	api.AssertIsEqual(m_.Y, circuit.MY)
-	api.AssertIsEqual(_U.X, circuit.UX)
-	api.AssertIsEqual(_U.Y, circuit.UY)
-	api.AssertIsEqual(_V.X, circuit.VX)
-	api.AssertIsEqual(_V.Y, circuit.VY)
+
+	PK := twistededwards1.Point{
+		X: circuit.PKX,
+		Y: circuit.PKY,
+	}
+	_Y, err := defineEnc(api, curve, base, m_, circuit.MX, circuit.MY, PK, &encVars{circuit.V, circuit.UX, circuit.UY, circuit.VX, circuit.VY, circuit.W, circuit.W1, circuit.W2, circuit.KID})
+	if err != nil {
+		return err
+	}
 	api.AssertIsEqual(_Y.X, circuit.YX)
 	api.AssertIsEqual(_Y.Y, circuit.YY)
 
+	ind2 := curve.ScalarMul(H, circuit.S)
+	B_ := curve.Add(m_, ind2)
+	api.AssertIsEqual(B_.X, circuit.BX)
+	api.AssertIsEqual(B_.Y, circuit.BY)
+
+	return nil
+
+}
+
+// PKECtVars is one ciphertext in a circuit: the nonce V and the public inputs
+// that Enc produces for a supervisor key PK. Y = PK^V stays inside the
+// circuit, since it opens the ciphertext.
+type PKECtVars struct {
+	V frontend.Variable
+
+	PKX frontend.Variable `gnark:",public"`
+	PKY frontend.Variable `gnark:",public"`
+	UX  frontend.Variable `gnark:",public"`
+	UY  frontend.Variable `gnark:",public"`
+	VX  frontend.Variable `gnark:",public"`
+	VY  frontend.Variable `gnark:",public"`
+
+	W  frontend.Variable `gnark:",public"`
+	W1 frontend.Variable `gnark:",public"`
+	W2 frontend.Variable `gnark:",public"`
+
+	KID frontend.Variable `gnark:",public"`
+}
+
+// defineCt constrains ct to be Enc of m_ = (mx, my) under ct.PK with nonce ct.V
+func defineCt(api frontend.API, curve twistededwards1.Curve, base, m_ twistededwards1.Point, mx, my frontend.Variable, ct *PKECtVars) error {
+	PK := twistededwards1.Point{
+		X: ct.PKX,
+		Y: ct.PKY,
+	}
+	_, err := defineEnc(api, curve, base, m_, mx, my, PK, &encVars{ct.V, ct.UX, ct.UY, ct.VX, ct.VY, ct.W, ct.W1, ct.W2, ct.KID})
+	return err
+}
+
+// encVars are the variables of one encryption besides the key
+type encVars struct {
+	V              frontend.Variable
+	UX, UY, VX, VY frontend.Variable
+	W, W1, W2      frontend.Variable
+	KID            frontend.Variable
+}
+
+// defineEnc constrains ct to be Enc of m_ = (mx, my) under PK with nonce ct.V
+// and returns Y = PK^V
+func defineEnc(api frontend.API, curve twistededwards1.Curve, base, m_ twistededwards1.Point, mx, my frontend.Variable, PK twistededwards1.Point, ct *encVars) (twistededwards1.Point, error) {
+	_U := curve.ScalarMul(base, ct.V)
+	_V := curve.ScalarMul(m_, ct.V)
+	_Y := curve.ScalarMul(PK, ct.V)
+
+	api.AssertIsEqual(_U.X, ct.UX)
+	api.AssertIsEqual(_U.Y, ct.UY)
+	api.AssertIsEqual(_V.X, ct.VX)
+	api.AssertIsEqual(_V.Y, ct.VY)
+
 	miMC, err := mimc.NewMiMC(api)
 	if err != nil {
-		return err
+		return _Y, err
 	}
 
 	One := curve.ScalarMul(base, 1)
-	miMC.Write(_U.X, _U.Y, _V.X, _V.Y, _Y.X, _Y.Y, One.X, One.Y)
+	miMC.Write(_U.X, _U.Y, _V.X, _V.Y, _Y.X, _Y.Y, ct.KID, One.X, One.Y)
 	hOut := miMC.Sum()
 
 	Two := curve.ScalarMul(base, 2)
@@ -87,9 +166,9 @@ func (circuit *PKECricuit) Define(api frontend.API) error {
 	hBits1 := api.ToBinary(hOut1, 256)
 	hBits2 := api.ToBinary(hOut2, 256)
 
-	vBits := api.ToBinary(circuit.V, 256)
-	mxBits := api.ToBinary(circuit.MX, 256)
-	myBits := api.ToBinary(circuit.MY, 256)
+	vBits := api.ToBinary(ct.V, 256)
+	mxBits := api.ToBinary(mx, 256)
+	myBits := api.ToBinary(my, 256)
 
 	wBits := make([]frontend.Variable, 256)
 	wBits1 := make([]frontend.Variable, 256)
@@ -102,17 +181,11 @@ func (circuit *PKECricuit) Define(api frontend.API) error {
 	}
 
 	wb := api.FromBinary(wBits...)
-	api.AssertIsEqual(circuit.W, wb)
+	api.AssertIsEqual(ct.W, wb)
 	wb1 := api.FromBinary(wBits1...)
-	api.AssertIsEqual(circuit.W1, wb1)
+	api.AssertIsEqual(ct.W1, wb1)
 	wb2 := api.FromBinary(wBits2...)
-	api.AssertIsEqual(circuit.W2, wb2)
-
-	ind2 := curve.ScalarMul(H, circuit.S)
-	B_ := curve.Add(m_, ind2)
-	api.AssertIsEqual(B_.X, circuit.BX)
-	api.AssertIsEqual(B_.Y, circuit.BY)
-
-	return nil
+	api.AssertIsEqual(ct.W2, wb2)
 
+	return _Y, nil
 }
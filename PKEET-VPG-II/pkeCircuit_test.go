@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
 	"fmt"
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
@@ -10,44 +9,38 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 	"io"
-	"math/big"
 	"testing"
 )
 
 func TestCircuit(t *testing.T) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	crs := &PKECRS{&curve.Base, getRandomG()}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, sk)
+	pk := jubjubMul(crs.gj, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, x)
-	s, _ := rand.Int(rand.Reader, mod)
-	B := new(twistededwards.PointAffine).Add(m, new(twistededwards.PointAffine).ScalarMultiplication(crs.hj, s))
+	x, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	s, _ := randJubjubScalar()
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, s))
 
-	v, _ := rand.Int(rand.Reader, mod)
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(key.pk, v)
+	v, _ := randJubjubScalar()
+	Y := jubjubMul(key.pk, v)
 
-	ct, err := Enc(crs, key.pk, m, v)
+	ct, err := Enc(crs, key.pk, 1, m, v)
 	if err != nil {
 		panic(err)
 	}
 
-	vBytes := BigIntToFixed32Bytes(v)
-	xBytes := BigIntToFixed32Bytes(x)
-	sBytes := BigIntToFixed32Bytes(s)
-
 	assignment := &PKECricuit{
-		V:   new(big.Int).SetBytes(vBytes[:]),
-		X:   new(big.Int).SetBytes(xBytes[:]),
-		S:   new(big.Int).SetBytes(sBytes[:]),
+		V:   v,
+		X:   x,
+		S:   s,
 		MX:  m.X,
 		MY:  m.Y,
 		HX:  crs.hj.X,
@@ -65,6 +58,7 @@ func TestCircuit(t *testing.T) {
 		W2:  ct.W[2],
 		BX:  B.X,
 		BY:  B.Y,
+		KID: ct.Epoch,
 	}
 	var pCircuit PKECricuit
 	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &pCircuit)
@@ -127,39 +121,34 @@ func BenchmarkCircuitSetup(b *testing.B) {
 
 func BenchmarkCircuitProve(b *testing.B) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	h := getRandomG()
 	crs := &PKECRS{&curve.Base, h}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, sk)
+	pk := jubjubMul(crs.gj, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, x)
-	s, err := rand.Int(rand.Reader, mod)
-	B := new(twistededwards.PointAffine).Add(m, new(twistededwards.PointAffine).ScalarMultiplication(crs.hj, s))
+	x, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	s, err := randJubjubScalar()
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, s))
 
-	v, _ := rand.Int(rand.Reader, mod)
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(key.pk, v)
+	v, _ := randJubjubScalar()
+	Y := jubjubMul(key.pk, v)
 
-	ct, err := Enc(crs, key.pk, m, v)
+	ct, err := Enc(crs, key.pk, 1, m, v)
 	if err != nil {
 		panic(err)
 	}
 
-	vBytes := BigIntToFixed32Bytes(v)
-	xBytes := BigIntToFixed32Bytes(x)
-	sBytes := BigIntToFixed32Bytes(s)
-
 	assignment := &PKECricuit{
-		V:   new(big.Int).SetBytes(vBytes[:]),
-		X:   new(big.Int).SetBytes(xBytes[:]),
-		S:   new(big.Int).SetBytes(sBytes[:]),
+		V:   v,
+		X:   x,
+		S:   s,
 		MX:  m.X,
 		MY:  m.Y,
 		HX:  crs.hj.X,
@@ -177,6 +166,7 @@ func BenchmarkCircuitProve(b *testing.B) {
 		W2:  ct.W[2],
 		BX:  B.X,
 		BY:  B.Y,
+		KID: ct.Epoch,
 	}
 	var pCircuit PKECricuit
 	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &pCircuit)
@@ -201,39 +191,34 @@ func BenchmarkCircuitProve(b *testing.B) {
 
 func BenchmarkCircuitVerify(b *testing.B) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	h := getRandomG()
 	crs := &PKECRS{&curve.Base, h}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, sk)
+	pk := jubjubMul(crs.gj, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, x)
-	s, err := rand.Int(rand.Reader, mod)
-	B := new(twistededwards.PointAffine).Add(m, new(twistededwards.PointAffine).ScalarMultiplication(crs.hj, s))
+	x, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	s, err := randJubjubScalar()
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, s))
 
-	v, _ := rand.Int(rand.Reader, mod)
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(key.pk, v)
+	v, _ := randJubjubScalar()
+	Y := jubjubMul(key.pk, v)
 
-	ct, err := Enc(crs, key.pk, m, v)
+	ct, err := Enc(crs, key.pk, 1, m, v)
 	if err != nil {
 		panic(err)
 	}
 
-	vBytes := BigIntToFixed32Bytes(v)
-	xBytes := BigIntToFixed32Bytes(x)
-	sBytes := BigIntToFixed32Bytes(s)
-
 	assignment := &PKECricuit{
-		V:   new(big.Int).SetBytes(vBytes[:]),
-		X:   new(big.Int).SetBytes(xBytes[:]),
-		S:   new(big.Int).SetBytes(sBytes[:]),
+		V:   v,
+		X:   x,
+		S:   s,
 		MX:  m.X,
 		MY:  m.Y,
 		HX:  crs.hj.X,
@@ -251,6 +236,7 @@ func BenchmarkCircuitVerify(b *testing.B) {
 		W2:  ct.W[2],
 		BX:  B.X,
 		BY:  B.Y,
+		KID: ct.Epoch,
 	}
 	var pCircuit PKECricuit
 	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &pCircuit)
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/rand"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -9,28 +8,27 @@ import (
 
 func TestPKEEncDec(t *testing.T) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	h := getRandomG()
 	crs := &PKECRS{&curve.Base, h}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, sk)
+	pk := jubjubMul(&curve.Base, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, x)
-	v, _ := rand.Int(rand.Reader, mod)
+	x, _ := randJubjubScalar()
+	m := jubjubMul(&curve.Base, x)
+	v, _ := randJubjubScalar()
 
-	ct, err := Enc(crs, key.pk, m, v)
+	ct, err := Enc(crs, key.pk, 0, m, v)
 	if err != nil {
 		panic(err)
 	}
 
-	m_, err := Dec(crs, ct, key.sk)
+	m_, err := Dec(crs, ct, key)
 	if err != nil {
 		panic(err)
 	}
@@ -39,53 +37,51 @@ func TestPKEEncDec(t *testing.T) {
 
 func BenchmarkPKEEnc(b *testing.B) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	h := getRandomG()
 	crs := &PKECRS{&curve.Base, h}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, sk)
+	pk := jubjubMul(&curve.Base, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, x)
-	v, _ := rand.Int(rand.Reader, mod)
+	x, _ := randJubjubScalar()
+	m := jubjubMul(&curve.Base, x)
+	v, _ := randJubjubScalar()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = Enc(crs, key.pk, m, v)
+		_, _ = Enc(crs, key.pk, 0, m, v)
 	}
 }
 
 func BenchmarkPKEDec(b *testing.B) {
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	h := getRandomG()
 	crs := &PKECRS{&curve.Base, h}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, sk)
+	pk := jubjubMul(&curve.Base, sk.element())
 	key := &Key{sk, pk}
 
-	x, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(&curve.Base, x)
-	v, _ := rand.Int(rand.Reader, mod)
+	x, _ := randJubjubScalar()
+	m := jubjubMul(&curve.Base, x)
+	v, _ := randJubjubScalar()
 
-	ct, err := Enc(crs, key.pk, m, v)
+	ct, err := Enc(crs, key.pk, 0, m, v)
 	if err != nil {
 		panic(err)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = Dec(crs, ct, key.sk)
+		_, _ = Dec(crs, ct, key)
 	}
 }
@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"github.com/consensys/gnark-crypto/ecc"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"math/big"
+	"os"
+	"runtime"
 	"time"
 )
 
 type PKEETVPG struct {
-	x, k *big.Int
+	x, k SecretScalar
 	C    *bls12381.G1Affine
 }
 
@@ -29,7 +32,9 @@ type CRS struct {
 }
 
 type PKEETVPGProof struct {
-	B *twistededwards.PointAffine
+	Epoch uint32
+	B     *twistededwards.PointAffine
+	ct    *Ciphertext
 
 	pubWit     witness.Witness
 	snarkProof groth16.Proof
@@ -38,30 +43,95 @@ type PKEETVPGProof struct {
 	cgp []*CGProof
 }
 
-func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, H *bls12381.G1Affine) (*PKEETVPGProof, error) {
-	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
-	order := bls12381.ID.ScalarField()
+// Proof encrypts m = gj^x to the supervisor key pk of the given epoch and proves
+// the statement with the epoch as a SNARK public input
+func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, epoch uint32, H *bls12381.G1Affine) (*PKEETVPGProof, error) {
+	return pv.proof(crs, pk, epoch, H, nil)
+}
 
-	// 0. Encrypt
-	v, _ := rand.Int(rand.Reader, mod)
-	m := new(twistededwards.PointAffine).ScalarMultiplication(crs.gj, pv.x)
-	ct, err := Enc(crs.PKECRS, pk, m, v)
+// ProofTest is Proof with equality-test tags for the trapdoor behind tpk,
+// proven in the SNARK. crs must be set up for TagPKECricuit.
+func (pv *PKEETVPG) ProofTest(crs *CRS, pk *twistededwards.PointAffine, tpk *TrapdoorKey, epoch uint32, H *bls12381.G1Affine) (*PKEETVPGProof, error) {
+	if err := checkTrapdoorKey(tpk); err != nil {
+		return nil, err
+	}
+	return pv.proof(crs, pk, epoch, H, tagAssign(tpk))
+}
+
+// ProofPayload is Proof with an attribute payload encrypted next to m. crs must
+// be set up for PayloadPKECricuit with len(payload) elements.
+func (pv *PKEETVPG) ProofPayload(crs *CRS, pk *twistededwards.PointAffine, epoch uint32, payload []fr.Element, H *bls12381.G1Affine) (*PKEETVPGProof, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+	return pv.proof(crs, pk, epoch, H, payloadAssign(payload))
+}
+
+func (pv *PKEETVPG) proof(crs *CRS, pk *twistededwards.PointAffine, epoch uint32, H *bls12381.G1Affine, assign encAssign) (*PKEETVPGProof, error) {
+	// ephemeral nonce of B, wiped once the proof is done
+	var s fr.Element
+	defer wipeElement(&s)
+	r, err := randJubjubScalar()
+	if err != nil {
+		return nil, err
+	}
+	s.Set(r)
+	wipeElement(r)
+
+	// 0. Encrypt and 1. zkSNARKs
+	ct, B, publicWitness, snarkProof, err := proveEnc(crs.ccs, crs.spk, crs.PKECRS, pk, epoch, pv.x.element(), &s, assign)
 	if err != nil {
 		return nil, err
 	}
 
+	// 2. PoK and 3. CGPoK
+	pkp, cgp, err := pv.proveOpening(crs, &s, H)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKEETVPGProof{
+		Epoch:      epoch,
+		B:          B,
+		ct:         ct,
+		pubWit:     publicWitness,
+		snarkProof: snarkProof,
+		pkp:        pkp,
+		cgp:        cgp,
+	}, nil
+}
+
+// encAssign completes ct for the circuit of a CRS and returns the assignment of
+// that circuit, given the one of PKECricuit, m, Y = pk^v and the nonce v
+type encAssign func(base *PKECricuit, ct *Ciphertext, m, Y *twistededwards.PointAffine, v *fr.Element) frontend.Circuit
+
+// proveEnc encrypts m = gj^x to pk and proves in PKECricuit, or in the circuit
+// assign fills in when set, that the ciphertext holds the m of B = m hj^s
+func proveEnc(ccs constraint.ConstraintSystem, spk groth16.ProvingKey, crs *PKECRS, pk *twistededwards.PointAffine, epoch uint32, x, s *fr.Element, assign encAssign) (*Ciphertext, *twistededwards.PointAffine, witness.Witness, groth16.Proof, error) {
+	// ephemeral nonce, wiped once the proof is done
+	var v fr.Element
+	defer wipeElement(&v)
+
+	// 0. Encrypt
+	r, err := randJubjubScalar()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	v.Set(r)
+	wipeElement(r)
+	m := jubjubMul(crs.gj, x)
+	ct, err := Enc(crs, pk, epoch, m, &v)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
 	// 1. zkSNARKs
-	s, _ := rand.Int(rand.Reader, mod)
-	B := new(twistededwards.PointAffine).Add(m, new(twistededwards.PointAffine).ScalarMultiplication(crs.hj, s))
-	Y := new(twistededwards.PointAffine).ScalarMultiplication(pk, v)
-	vBytes := BigIntToFixed32Bytes(v)
-	xBytes := BigIntToFixed32Bytes(pv.x)
-	sBytes := BigIntToFixed32Bytes(s)
-	assignment := &PKECricuit{
-		V:   new(big.Int).SetBytes(vBytes[:]),
-		X:   new(big.Int).SetBytes(xBytes[:]),
-		S:   new(big.Int).SetBytes(sBytes[:]),
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, s))
+	Y := jubjubMul(pk, &v)
+	base := PKECricuit{
+		V:   &v,
+		X:   x,
+		S:   s,
 		MX:  m.X,
 		MY:  m.Y,
 		HX:  crs.hj.X,
@@ -79,6 +149,11 @@ func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, H *bls12381.
 		W2:  ct.W[2],
 		BX:  B.X,
 		BY:  B.Y,
+		KID: epoch,
+	}
+	var assignment frontend.Circuit = &base
+	if assign != nil {
+		assignment = assign(&base, ct, m, Y, &v)
 	}
 	secretWitness, err := frontend.NewWitness(assignment, ecc.BLS12_381.ScalarField())
 	if err != nil {
@@ -88,19 +163,30 @@ func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, H *bls12381.
 	if err != nil {
 		panic(err)
 	}
-	snarkProof, err := groth16.Prove(crs.ccs, crs.spk, secretWitness)
+	snarkProof, err := groth16.Prove(ccs, spk, secretWitness)
+	wipeWitness(secretWitness)
 	if err != nil {
 		panic(err)
 	}
+	return ct, B, publicWitness, snarkProof, nil
+}
+
+// proveOpening proves that the user behind C knows x with B = gj^x hj^s, using a
+// fresh X = H^nt for the PoK
+func (pv *PKEETVPG) proveOpening(crs *CRS, s *fr.Element, H *bls12381.G1Affine) (*PoKProof, []*CGProof, error) {
+	var nt fr.Element
+	defer wipeElement(&nt)
 
 	// 2. PoK
-	nt, _ := rand.Int(rand.Reader, order)
-	m_ := new(bls12381.G2Affine).ScalarMultiplication(crs.g_, pv.x)
-	sec := &PoKSec{pv.x, pv.k, nt, m_}
+	if _, err := nt.SetRandom(); err != nil {
+		return nil, nil, err
+	}
+	m_ := g2Mul(crs.g_, pv.x.element())
+	sec := &PoKSec{pv.x, pv.k, SecretScalar{&nt}, m_}
 
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, pv.x), new(bls12381.G1Affine).ScalarMultiplication(crs.h, pv.k))
-	V_ := new(bls12381.G2Affine).ScalarMultiplication(m_, nt)
-	X := new(bls12381.G1Affine).ScalarMultiplication(H, nt)
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, pv.x.element()), g1Mul(crs.h, pv.k.element()))
+	V_ := g2Mul(m_, &nt)
+	X := g1Mul(H, &nt)
 
 	pkp, err := crs.GenPoKProof(sec, C, X, H, V_)
 	if err != nil {
@@ -108,22 +194,25 @@ func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, H *bls12381.
 	}
 
 	// 3. CGPoK
-	two128 := new(big.Int).Lsh(big.NewInt(1), uint(bx)) // 1 << 128
-	// low = x mod 2^128
-	lowX := new(big.Int).Mod(pv.x, two128)
-	lowRP := new(big.Int).Mod(s, two128)
-	lowRQ := new(big.Int).Mod(pv.k, two128)
-	// high = x >> 128
-	highX := new(big.Int).Rsh(pv.x, uint(bx))
-	highRP := new(big.Int).Rsh(s, uint(bx))
-	highRQ := new(big.Int).Rsh(pv.k, uint(bx))
-
-	lowXp := &XP{lowX, lowRP}
-	lowXq := &XQ{lowX, lowRQ}
-	highXp := &XP{highX, highRP}
-	highXq := &XQ{highX, highRQ}
-
-	cg := NewCGCRS(bc, bx, bf, tau, crs.gj, crs.hj, crs.g, crs.h)
+	// low = x mod 2^128, high = x >> 128
+	lowX, highX := splitLimbs(pv.x.element().Bits(), uint(bx))
+	lowRP, highRP := splitLimbs(s.Bits(), uint(bx))
+	lowRQ, highRQ := splitLimbs(pv.k.element().Bits(), uint(bx))
+
+	lowXp := &XP{frFromLimbs(lowX), frFromLimbs(lowRP)}
+	lowXq := &XQ{frFromLimbs(lowX), frFromLimbs(lowRQ)}
+	highXp := &XP{frFromLimbs(highX), frFromLimbs(highRP)}
+	highXq := &XQ{frFromLimbs(highX), frFromLimbs(highRQ)}
+	for _, l := range []*[4]uint64{&lowX, &highX, &lowRP, &highRP, &lowRQ, &highRQ} {
+		wipeLimbs(l)
+	}
+	defer func() {
+		for _, e := range []*fr.Element{lowXp.x, lowXp.rp, lowXq.x, lowXq.rq, highXp.x, highXp.rp, highXq.x, highXq.rq} {
+			wipeElement(e)
+		}
+	}()
+
+	cg := crs.CGCRS()
 
 	//comP := new(twistededwards.PointAffine).Add(new(twistededwards.PointAffine).ScalarMultiplication(cg.Gp, pv.x), new(twistededwards.PointAffine).ScalarMultiplication(cg.Hp, s))
 	//comQ := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(cg.Gq, pv.x), new(bls12381.G1Affine).ScalarMultiplication(cg.Hq, pv.k))
@@ -137,55 +226,174 @@ func (pv *PKEETVPG) Proof(crs *CRS, pk *twistededwards.PointAffine, H *bls12381.
 		panic(err)
 	}
 
-	return &PKEETVPGProof{
-		B:          B,
-		pubWit:     publicWitness,
-		snarkProof: snarkProof,
-		pkp:        pkp,
-		cgp:        append(lowCGP, highCGP...),
-	}, nil
+	return pkp, append(lowCGP, highCGP...), nil
+}
+
+// Verify checks pvp, with the ciphertext made for the key keys gives for
+// pvp.Epoch and the PoK made for the H of context. A ciphertext with a payload
+// is checked against the public inputs of PayloadPKECricuit. Tagged
+// ciphertexts go through VerifyTest.
+func Verify(crs *CRS, keys EpochKeys, context []byte, pvp *PKEETVPGProof) error {
+	return verify(crs, keys, nil, context, pvp)
+}
+
+// VerifyTest is Verify for a proof made by ProofTest, with the tags made for
+// the trapdoor key tpks gives for pvp.Epoch
+func VerifyTest(crs *CRS, keys EpochKeys, tpks EpochTrapdoorKeys, context []byte, pvp *PKEETVPGProof) error {
+	if tpks == nil {
+		return errors.New("no trapdoor keys")
+	}
+	return verify(crs, keys, tpks, context, pvp)
 }
 
-func Verify(crs *CRS, pvp *PKEETVPGProof) error {
+func verify(crs *CRS, keys EpochKeys, tpks EpochTrapdoorKeys, context []byte, pvp *PKEETVPGProof) error {
+	if pvp == nil || pvp.B == nil || pvp.pubWit == nil || pvp.snarkProof == nil || pvp.pkp == nil || pvp.ct == nil {
+		return errors.New("malformed proof")
+	}
+	if tpks == nil {
+		if err := checkNoTag(pvp.ct); err != nil {
+			return err
+		}
+	} else if pvp.ct.Tag == nil {
+		return errors.New("ciphertext has no equality-test tag")
+	}
+	pk, err := keys.PublicKey(pvp.Epoch)
+	if err != nil {
+		return err
+	}
 	// 1. zkSNARKs verify
-	err := groth16.Verify(pvp.snarkProof, crs.svk, pvp.pubWit)
+	err = groth16.Verify(pvp.snarkProof, crs.svk, pvp.pubWit)
 	if err != nil {
 		return errors.New("snark verification failed: " + err.Error())
 	}
+	hx, pkx, ux, w, bx, kid := pubHX, pubPKX, pubUX, pubW, pubBX, pubKID
+	if pvp.ct.Payload != nil || tpks != nil {
+		hx, pkx, ux, w, bx, kid = vpubHX, vpubPKX, vpubUX, vpubW, vpubBX, vpubKID
+	}
+	pub, err := pvp.publicInputs(kid)
+	if err != nil {
+		return err
+	}
+	if err = checkKeyInputs(crs.PKECRS, pk, pub, hx, pkx); err != nil {
+		return err
+	}
+	if err = checkCtInputs(pvp.ct, pub, ux, w, kid); err != nil {
+		return err
+	}
+	if pvp.ct.Epoch != pvp.Epoch {
+		return errors.New("key epoch does not match the snark statement")
+	}
+	rest := pub[kid+1:]
+	if tpks != nil {
+		tpk, err := tpks.TrapdoorKey(pvp.Epoch)
+		if err != nil {
+			return err
+		}
+		if err = checkTagInputs(pvp.ct, tpk, pub); err != nil {
+			return err
+		}
+		rest = pub[tpubTagC+1:]
+	}
+	if err = checkPayloadInputs(pvp.ct, rest); err != nil {
+		return err
+	}
+	if !pvp.B.X.Equal(&pub[bx]) || !pvp.B.Y.Equal(&pub[bx+1]) {
+		return errors.New("B does not match the snark statement")
+	}
 
+	return verifyOpening(crs, context, pvp.B, pvp.pkp, pvp.cgp)
+}
+
+// checkKeyInputs checks hj and the supervisor key pk against the public
+// witness, with hj at hx and pk at pkx
+func checkKeyInputs(crs *PKECRS, pk *twistededwards.PointAffine, pub fr.Vector, hx, pkx int) error {
+	if !crs.hj.X.Equal(&pub[hx]) || !crs.hj.Y.Equal(&pub[hx+1]) {
+		return errors.New("hj does not match the snark statement")
+	}
+	if !pk.X.Equal(&pub[pkx]) || !pk.Y.Equal(&pub[pkx+1]) {
+		return errors.New("supervisor key does not match the snark statement")
+	}
+	return nil
+}
+
+// checkCtInputs checks ct against the public witness, with U, V starting at ux,
+// the W masks at w and the epoch at kid
+func checkCtInputs(ct *Ciphertext, pub fr.Vector, ux, w, kid int) error {
+	if ct == nil || ct.U == nil || ct.V == nil {
+		return errors.New("malformed ciphertext")
+	}
+	if !pub[kid].Equal(new(fr.Element).SetUint64(uint64(ct.Epoch))) {
+		return errors.New("key epoch does not match the snark statement")
+	}
+	if !ct.U.X.Equal(&pub[ux]) || !ct.U.Y.Equal(&pub[ux+1]) || !ct.V.X.Equal(&pub[ux+2]) || !ct.V.Y.Equal(&pub[ux+3]) {
+		return errors.New("ciphertext does not match the snark statement")
+	}
+	for i := range ct.W {
+		if !new(fr.Element).SetBigInt(&ct.W[i]).Equal(&pub[w+i]) {
+			return errors.New("ciphertext does not match the snark statement")
+		}
+	}
+	return nil
+}
+
+// verifyOpening checks the PoK and CGPoK parts, which tie B to the commitment C
+func verifyOpening(crs *CRS, context []byte, B *twistededwards.PointAffine, pkp *PoKProof, cgp []*CGProof) error {
+	if len(cgp) != 4 {
+		return errors.New("cgpok verification failed: expected 4 proofs")
+	}
+	if err := checkH(pkp, context); err != nil {
+		return err
+	}
 	// 2. PoK verify
-	err = crs.VerPoKProof(pvp.pkp)
+	err := crs.VerPoKProof(pkp)
 	if err != nil {
 		return errors.New("pok verification failed: " + err.Error())
 	}
 
 	// 3. CGPoK verify
-	cg := NewCGCRS(bc, bx, bf, tau, crs.gj, crs.hj, crs.g, crs.h)
-	err = cg.VerXPs(pvp.cgp[:2])
+	cg := crs.CGCRS()
+	err = cg.VerXPs(cgp[:2])
 	if err != nil {
 		return errors.New("cgpok verification failed: " + err.Error())
 	}
-	err = cg.VerXPs(pvp.cgp[2:])
+	err = cg.VerXPs(cgp[2:])
 	if err != nil {
 		return errors.New("cgpok verification failed: " + err.Error())
 	}
 
 	two128 := new(big.Int).Lsh(big.NewInt(1), uint(bx)) // 1 << 128
-	mergeP := new(twistededwards.PointAffine).Add(pvp.cgp[0].comP, new(twistededwards.PointAffine).ScalarMultiplication(pvp.cgp[2].comP, two128))
-	mergeQ := new(bls12381.G1Affine).Add(pvp.cgp[0].comQ, new(bls12381.G1Affine).ScalarMultiplication(pvp.cgp[2].comQ, two128))
-	if !pvp.B.Equal(mergeP) || !pvp.pkp.C.Equal(mergeQ) {
-		return errors.New("cgpok-merge verification failed: " + err.Error())
+	mergeP := new(twistededwards.PointAffine).Add(cgp[0].comP, new(twistededwards.PointAffine).ScalarMultiplication(cgp[2].comP, two128))
+	mergeQ := new(bls12381.G1Affine).Add(cgp[0].comQ, new(bls12381.G1Affine).ScalarMultiplication(cgp[2].comQ, two128))
+	if !B.Equal(mergeP) || !pkp.C.Equal(mergeQ) {
+		return errors.New("cgpok-merge verification failed")
 	}
 
 	return nil
 }
 
+// Ciphertext returns the encryption of m proven by pvp, for the supervisor of
+// pvp.Epoch to decrypt. Verify checks it against the snark statement.
+func (pvp *PKEETVPGProof) Ciphertext() *Ciphertext {
+	return pvp.ct
+}
+
+// publicInputs returns the public witness of pvp, which must go at least up to
+// the epoch at kid
+func (pvp *PKEETVPGProof) publicInputs(kid int) (fr.Vector, error) {
+	pub, ok := pvp.pubWit.Vector().(fr.Vector)
+	if !ok || len(pub) <= kid {
+		return nil, errors.New("malformed public witness")
+	}
+	return pub, nil
+}
+
 type RLight struct {
 	ht *bls12381.G1Affine
 	mt *bls12381.G2Affine
 }
 
 type RBatch struct {
+	ctx []byte
 	h   *bls12381.G1Affine
 	rec []*RLight
 }
@@ -219,30 +427,87 @@ func TestRLight(rl1, rl2 *RLight) error {
 	return errors.New("")
 }
 
+// traceKey is a token prepared for traceSP. Its mt is fixed for every record
+// of the batch, so the lines of its Miller loop are computed once, and each
+// record costs one pairing check
+//
+//	e(ht, rl.mt) * e(-rl.ht, mt) == 1
+//
+// instead of the two full pairings of TestRLight.
+type traceKey struct {
+	ht    bls12381.G1Affine
+	lines [2][len(bls12381.LoopCounter) - 1]bls12381.LineEvaluationAff
+}
+
+func newTraceKey(rl *RLight) *traceKey {
+	return &traceKey{*rl.ht, bls12381.PrecomputeLines(*rl.mt)}
+}
+
+// match reports whether rl is a record of the target of the token
+func (tk *traceKey) match(rl *RLight) bool {
+	var nht bls12381.G1Affine
+	nht.Neg(rl.ht)
+	f, err := bls12381.MillerLoop([]bls12381.G1Affine{tk.ht}, []bls12381.G2Affine{*rl.mt})
+	if err != nil {
+		panic(err)
+	}
+	return tk.check(&f, &nht)
+}
+
+// check completes f, the Miller loop of e(ht, rl.mt), with e(-rl.ht, mt) and
+// reports whether the product is one. nht is -rl.ht.
+func (tk *traceKey) check(f *bls12381.GT, nht *bls12381.G1Affine) bool {
+	// MillerLoopFixedQ evaluates the lines in place, so it gets a copy
+	lines := [][2][len(bls12381.LoopCounter) - 1]bls12381.LineEvaluationAff{tk.lines}
+	fq, err := bls12381.MillerLoopFixedQ([]bls12381.G1Affine{*nht}, lines)
+	if err != nil {
+		panic(err)
+	}
+	fq.Mul(&fq, f)
+	fq = bls12381.FinalExponentiation(&fq)
+	return fq.IsOne()
+}
+
+// GenerateRecordsLight simulates an SP on benchSchedule that receives
+// batchSize records in each of total/batchSize epochs
 func GenerateRecordsLight(m *bls12381.G2Affine, total, rate, batchSize int) (map[int]*RBatch, error) {
-	groups := make(map[int]*RBatch)
+	er := NewEpochRecords(benchSchedule)
+	err := generateRecordsLight(m, total, rate, batchSize, func(epoch uint64, h *bls12381.G1Affine, rl *RLight) error {
+		return er.Add(epoch, rl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	groups, _ := er.Batches()
+	return groups, nil
+}
+
+// generateRecordsLight makes the records of GenerateRecordsLight one at a time
+// and hands each to yield with its epoch and generator. A record is for m with
+// probability 1/rate.
+func generateRecordsLight(m *bls12381.G2Affine, total, rate, batchSize int, yield func(epoch uint64, h *bls12381.G1Affine, rl *RLight) error) error {
 	batches := total / batchSize
 	one := big.NewInt(1)
 	for i := 0; i < batches; i++ {
-		sg := make([]*RLight, batchSize)
-		h := getRandomG1()
+		h, err := benchSchedule.H(uint64(i))
+		if err != nil {
+			return err
+		}
 		for j := 0; j < batchSize; j++ {
 			num, err := rand.Int(rand.Reader, big.NewInt(int64(rate)))
 			if err != nil {
-				panic(err)
+				return err
 			}
-			if num.Cmp(one) == 0 {
-				rl := getRLight(m, h)
-				sg[j] = rl
-			} else {
-				m_ := getRandomG2()
-				rl := getRLight(m_, h)
-				sg[j] = rl
+			m_ := m
+			if num.Cmp(one) != 0 {
+				m_ = getRandomG2()
+			}
+			if err = yield(uint64(i), h, getRLight(m_, h)); err != nil {
+				return err
 			}
 		}
-		groups[i] = &RBatch{h, sg}
 	}
-	return groups, nil
+	return nil
 }
 
 func traceR1(rec map[int]*RBatch, m *bls12381.G2Affine) map[int]*RBD {
@@ -253,20 +518,25 @@ func traceR1(rec map[int]*RBatch, m *bls12381.G2Affine) map[int]*RBD {
 	return groups
 }
 
+// traceSP returns the positions of the matching records, counted across the
+// batches in order. Batches of an epoch schedule need not have the same size.
 func traceSP(group map[int]*RBatch, bd map[int]*RBD) ([]int, error) {
 	var match []int
 	if len(group) != len(bd) {
 		return nil, errors.New("length mismatch")
 	}
+	off := 0
 	for i := 0; i < len(group); i++ {
 		if !group[i].h.Equal(bd[i].h) {
 			return nil, errors.New("h mismatch")
 		}
+		tk := newTraceKey(bd[i].RLight)
 		for j := 0; j < len(group[i].rec); j++ {
-			if TestRLight(bd[i].RLight, group[i].rec[j]) == nil {
-				match = append(match, i*len(group[i].rec)+j)
+			if tk.match(group[i].rec[j]) {
+				match = append(match, off+j)
 			}
 		}
+		off += len(group[i].rec)
 	}
 	return match, nil
 }
@@ -318,7 +588,24 @@ func BatchTracePKEETVPGTest(iterations, total, rate, batchSize int) {
 	fmt.Printf("Average execution time over TraceSP runs: %v\n", avgT[2])
 }
 
+func serveTraceShard(path string) error {
+	st, err := OpenRecordStore(path)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return ServeTraceShard(st, os.Stdin, os.Stdout, runtime.NumCPU())
+}
+
 func main() {
+	// an SP process of TraceSharded, over the store at the given path
+	if len(os.Args) > 2 && os.Args[1] == "trace-shard" {
+		if err := serveTraceShard(os.Args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	iterations := 20
 	//total := []int{1000, 5000, 10000, 50000, 100000}
 	total := []int{5000}
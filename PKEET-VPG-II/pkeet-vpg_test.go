@@ -1,13 +1,14 @@
 package main
 
 import (
-	"crypto/rand"
+	"fmt"
 	"github.com/consensys/gnark-crypto/ecc"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
 	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
@@ -25,44 +26,80 @@ func TestPKEETVPG(t *testing.T) {
 	}
 
 	// // Jubjub
-	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
-
-	hj := getRandomG()
-	pkeCrs := &PKECRS{&curve.Base, hj}
+	pkeCrs, err := NewPKECRS()
+	if err != nil {
+		panic(err)
+	}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(pkeCrs.gj, sk)
+	pk := jubjubMul(pkeCrs.gj, sk.element())
 	supKey := &Key{sk, pk}
 
 	// // bls12-381
-	_, _, g1, g2 := bls12381.Generators()
-	h := getRandomG1()
-	H := getRandomG1() // variable public generator
-	pokCrs := NewPoKCRS(&g1, h, &g2)
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH) // variable public generator
+	pokCrs, err := GenPoKCRS()
+	if err != nil {
+		panic(err)
+	}
 	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	assert.Nil(t, VerifyCRS(crs))
 
 	// 2. user setup
-	order := bls12381.ID.ScalarField()
-	x, _ := rand.Int(rand.Reader, mod)
-	k, _ := rand.Int(rand.Reader, order)
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(pokCrs.g, x), new(bls12381.G1Affine).ScalarMultiplication(pokCrs.h, k))
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
 	user := &PKEETVPG{x, k, C}
 
 	// 3. prove
-	pvp, err := user.Proof(crs, supKey.pk, H)
+	pvp, err := user.Proof(crs, supKey.pk, 5, H)
 	if err != nil {
 		panic(err)
 	}
 
-	// 4. verify
-	err = Verify(crs, pvp)
+	// 4. verify against the key of epoch 5
+	kr := NewKeyring()
+	assert.Nil(t, kr.Rotate(5, supKey))
+	err = Verify(crs, kr, ctxH, pvp)
 	if err != nil {
 		panic(err)
 	}
+	assert.Nil(t, Verify(crs, PublicKeyring{5: pk}, ctxH, pvp))
+
+	// 5. the supervisor of epoch 5 opens the proven ciphertext
+	ct := pvp.Ciphertext()
+	assert.Equal(t, uint32(5), ct.Epoch)
+	m, err := kr.Dec(pkeCrs, ct)
+	assert.Nil(t, err)
+	assert.True(t, m.Equal(jubjubMul(pkeCrs.gj, x.element())))
+
+	// the PoK is bound to the H of the context
+	assert.NotNil(t, Verify(crs, kr, batchContext(1), pvp))
+
+	// a tag attached after the proof is not trusted
+	ct.Tag = &EqTag{}
+	assert.NotNil(t, Verify(crs, kr, ctxH, pvp))
+	ct.Tag = nil
+
+	// a proof for another key labelled with epoch 5 is rejected
+	other, _ := RandSecretJubjub()
+	forged, err := user.Proof(crs, jubjubMul(pkeCrs.gj, other.element()), 5, H)
+	if err != nil {
+		panic(err)
+	}
+	assert.NotNil(t, Verify(crs, kr, ctxH, forged))
+
+	// a malformed proof is an error, not a panic
+	forged.ct = nil
+	assert.NotNil(t, Verify(crs, kr, ctxH, forged))
+	assert.NotNil(t, Verify(crs, kr, ctxH, &PKEETVPGProof{Epoch: 5}))
+
+	// the epoch is part of the snark statement
+	pvp.Epoch = 4
+	assert.NotNil(t, Verify(crs, PublicKeyring{4: pk}, ctxH, pvp))
 }
 
 func BenchmarkPKEETVPG_Proof(b *testing.B) {
@@ -80,36 +117,35 @@ func BenchmarkPKEETVPG_Proof(b *testing.B) {
 
 	// // Jubjub
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	hj := getRandomG()
 	pkeCrs := &PKECRS{&curve.Base, hj}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(pkeCrs.gj, sk)
+	pk := jubjubMul(pkeCrs.gj, sk.element())
 	supKey := &Key{sk, pk}
 
 	// // bls12-381
 	_, _, g1, g2 := bls12381.Generators()
 	h := getRandomG1()
-	H := getRandomG1() // variable public generator
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH) // variable public generator
 	pokCrs := NewPoKCRS(&g1, h, &g2)
 	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
 
 	// 2. user setup
-	order := bls12381.ID.ScalarField()
-	x, _ := rand.Int(rand.Reader, mod)
-	k, _ := rand.Int(rand.Reader, order)
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(pokCrs.g, x), new(bls12381.G1Affine).ScalarMultiplication(pokCrs.h, k))
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
 	user := &PKEETVPG{x, k, C}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		// 3. prove
-		_, _ = user.Proof(crs, supKey.pk, H)
+		_, _ = user.Proof(crs, supKey.pk, 0, H)
 	}
 }
 
@@ -128,41 +164,87 @@ func BenchmarkPKEETVPG_Verify(b *testing.B) {
 
 	// // Jubjub
 	curve := twistededwards.GetEdwardsCurve()
-	mod := &curve.Order
 
 	hj := getRandomG()
 	pkeCrs := &PKECRS{&curve.Base, hj}
 
-	sk, err := rand.Int(rand.Reader, mod)
+	sk, err := RandSecretJubjub()
 	if err != nil {
 		panic(err)
 	}
-	pk := new(twistededwards.PointAffine).ScalarMultiplication(pkeCrs.gj, sk)
+	pk := jubjubMul(pkeCrs.gj, sk.element())
 	supKey := &Key{sk, pk}
 
 	// // bls12-381
 	_, _, g1, g2 := bls12381.Generators()
 	h := getRandomG1()
-	H := getRandomG1() // variable public generator
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH) // variable public generator
 	pokCrs := NewPoKCRS(&g1, h, &g2)
 	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
 
 	// 2. user setup
-	order := bls12381.ID.ScalarField()
-	x, _ := rand.Int(rand.Reader, mod)
-	k, _ := rand.Int(rand.Reader, order)
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(pokCrs.g, x), new(bls12381.G1Affine).ScalarMultiplication(pokCrs.h, k))
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
 	user := &PKEETVPG{x, k, C}
 
 	// 3. prove
-	pvp, err := user.Proof(crs, supKey.pk, H)
+	pvp, err := user.Proof(crs, supKey.pk, 0, H)
 	if err != nil {
 		panic(err)
 	}
 
+	keys := PublicKeyring{0: supKey.pk}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		// 4. verify
-		_ = Verify(crs, pvp)
+		_ = Verify(crs, keys, ctxH, pvp)
+	}
+}
+
+func TestTraceKey(t *testing.T) {
+	h := getRandomG1()
+	m := getRandomG2()
+	tk := newTraceKey(getRLight(m, h))
+	for i := 0; i < 4; i++ {
+		target := m
+		if i%2 == 1 {
+			target = getRandomG2()
+		}
+		rl := getRLight(target, h)
+		assert.Equal(t, TestRLight(getRLight(m, h), rl) == nil, tk.match(rl))
+	}
+	assert.False(t, tk.match(getRLight(m, getRandomG1())))
+}
+
+// BenchmarkTraceSP compares traceSP with matching every record by TestRLight
+func BenchmarkTraceSP(b *testing.B) {
+	m := getRandomG2()
+	for _, total := range []int{64, 256} {
+		for _, batchSize := range []int{1, 16, 64} {
+			groups, err := GenerateRecordsLight(m, total, 2, batchSize)
+			if err != nil {
+				b.Fatal(err)
+			}
+			td := traceR1(groups, m)
+			name := fmt.Sprintf("total=%d/batchSize=%d", total, batchSize)
+			b.Run("TestRLight/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for k, g := range groups {
+						for _, rl := range g.rec {
+							_ = TestRLight(td[k].RLight, rl)
+						}
+					}
+				}
+			})
+			b.Run("traceSP/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := traceSP(groups, td); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
 	}
 }
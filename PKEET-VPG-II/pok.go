@@ -2,11 +2,11 @@ package main
 
 import "C"
 import (
-	"crypto/rand"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"math/big"
 )
 
@@ -22,7 +22,7 @@ type PoKProof struct {
 }
 
 type PoKSec struct {
-	x, k, t *big.Int
+	x, k, t SecretScalar
 	m_      *bls12381.G2Affine
 }
 
@@ -31,26 +31,29 @@ func NewPoKCRS(g, h *bls12381.G1Affine, g_ *bls12381.G2Affine) *PoKCRS {
 }
 
 func (crs *PoKCRS) GenPoKProof(sec *PoKSec, Cin, X, H *bls12381.G1Affine, V_ *bls12381.G2Affine) (*PoKProof, error) {
-	order := bls12381.ID.ScalarField()
-	d, err := rand.Int(rand.Reader, order)
-	if err != nil {
-		return nil, fmt.Errorf("fail to generate random number: %w", err)
+	var d, rx, rk, rt, rd, rw, w, negK, negRk fr.Element
+	nonces := []*fr.Element{&d, &rx, &rk, &rt, &rd, &rw, &w, &negK, &negRk}
+	defer func() {
+		for _, e := range nonces {
+			wipeElement(e)
+		}
+	}()
+	for _, r := range nonces[:6] {
+		if _, err := r.SetRandom(); err != nil {
+			return nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
 	}
-	w := new(big.Int).ModInverse(sec.t, order)
-
-	D := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, d), new(bls12381.G1Affine).ScalarMultiplication(crs.h, new(big.Int).Neg(sec.k)))
-	T_ := new(bls12381.G2Affine).Add(new(bls12381.G2Affine).ScalarMultiplication(V_, w), new(bls12381.G2Affine).ScalarMultiplication(crs.g_, d))
+	w.Exp(*sec.t.element(), frInvExp)
+	negK.Neg(sec.k.element())
+	negRk.Neg(&rk)
 
-	rx, _ := rand.Int(rand.Reader, order)
-	rk, _ := rand.Int(rand.Reader, order)
-	rt, _ := rand.Int(rand.Reader, order)
-	rd, _ := rand.Int(rand.Reader, order)
-	rw, _ := rand.Int(rand.Reader, order)
+	D := new(bls12381.G1Affine).Add(g1Mul(crs.g, &d), g1Mul(crs.h, &negK))
+	T_ := new(bls12381.G2Affine).Add(g2Mul(V_, &w), g2Mul(crs.g_, &d))
 
-	A1 := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, rx), new(bls12381.G1Affine).ScalarMultiplication(crs.h, rk))
-	A2 := new(bls12381.G1Affine).ScalarMultiplication(H, rt)
-	D1 := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, rd), new(bls12381.G1Affine).ScalarMultiplication(crs.h, new(big.Int).Neg(rk)))
-	T1_ := new(bls12381.G2Affine).Add(new(bls12381.G2Affine).ScalarMultiplication(V_, rw), new(bls12381.G2Affine).ScalarMultiplication(crs.g_, rd))
+	A1 := new(bls12381.G1Affine).Add(g1Mul(crs.g, &rx), g1Mul(crs.h, &rk))
+	A2 := g1Mul(H, &rt)
+	D1 := new(bls12381.G1Affine).Add(g1Mul(crs.g, &rd), g1Mul(crs.h, &negRk))
+	T1_ := new(bls12381.G2Affine).Add(g2Mul(V_, &rw), g2Mul(crs.g_, &rd))
 
 	arr := append(crs.g.Marshal(), crs.h.Marshal()...)
 	arr = append(arr, H.Marshal()...)
@@ -66,12 +69,14 @@ func (crs *PoKCRS) GenPoKProof(sec *PoKSec, Cin, X, H *bls12381.G1Affine, V_ *bl
 	arr = append(arr, T1_.Marshal()...)
 	res := sha256.Sum256(arr)
 	c := new(big.Int).SetBytes(res[:])
+	var cf fr.Element
+	cf.SetBigInt(c)
 
-	zx := new(big.Int).Mod(new(big.Int).Add(rx, new(big.Int).Mul(c, sec.x)), order)
-	zk := new(big.Int).Mod(new(big.Int).Add(rk, new(big.Int).Mul(c, sec.k)), order)
-	zt := new(big.Int).Mod(new(big.Int).Add(rt, new(big.Int).Mul(c, sec.t)), order)
-	zd := new(big.Int).Mod(new(big.Int).Add(rd, new(big.Int).Mul(c, d)), order)
-	zw := new(big.Int).Mod(new(big.Int).Add(rw, new(big.Int).Mul(c, w)), order)
+	zx := frResponse(&rx, &cf, sec.x.element())
+	zk := frResponse(&rk, &cf, sec.k.element())
+	zt := frResponse(&rt, &cf, sec.t.element())
+	zd := frResponse(&rd, &cf, &d)
+	zw := frResponse(&rw, &cf, &w)
 
 	return &PoKProof{c, zx, zk, zt, zd, zw, Cin, X, D, H, V_, T_}, nil
 }
@@ -1,31 +1,30 @@
 package main
 
 import (
-	"crypto/rand"
 	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
 func TestNewPoK(t *testing.T) {
 	_, _, g1, g2 := bls12381.Generators()
-	order := bls12381.ID.ScalarField()
 
 	crs := NewPoKCRS(&g1, getRandomG1(), &g2)
 	H := getRandomG1()
 
-	x, err := rand.Int(rand.Reader, order)
-	if err != nil {
+	var x, k, nt fr.Element
+	if _, err := x.SetRandom(); err != nil {
 		t.Fatal(err)
 	}
-	k, _ := rand.Int(rand.Reader, order)
-	nt, _ := rand.Int(rand.Reader, order)
-	m_ := new(bls12381.G2Affine).ScalarMultiplication(crs.g_, x)
-	sec := &PoKSec{x, k, nt, m_}
+	_, _ = k.SetRandom()
+	_, _ = nt.SetRandom()
+	m_ := g2Mul(crs.g_, &x)
+	sec := &PoKSec{SecretScalar{&x}, SecretScalar{&k}, SecretScalar{&nt}, m_}
 
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, x), new(bls12381.G1Affine).ScalarMultiplication(crs.h, k))
-	V_ := new(bls12381.G2Affine).ScalarMultiplication(m_, nt)
-	X := new(bls12381.G1Affine).ScalarMultiplication(H, nt)
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, &x), g1Mul(crs.h, &k))
+	V_ := g2Mul(m_, &nt)
+	X := g1Mul(H, &nt)
 
 	pkp, err := crs.GenPoKProof(sec, C, X, H, V_)
 	if err != nil {
@@ -37,23 +36,22 @@ func TestNewPoK(t *testing.T) {
 
 func BenchmarkPoKGen(b *testing.B) {
 	_, _, g1, g2 := bls12381.Generators()
-	order := bls12381.ID.ScalarField()
 
 	crs := NewPoKCRS(&g1, getRandomG1(), &g2)
 	H := getRandomG1()
 
-	x, err := rand.Int(rand.Reader, order)
-	if err != nil {
+	var x, k, nt fr.Element
+	if _, err := x.SetRandom(); err != nil {
 		b.Fatal(err)
 	}
-	k, _ := rand.Int(rand.Reader, order)
-	nt, _ := rand.Int(rand.Reader, order)
-	m_ := new(bls12381.G2Affine).ScalarMultiplication(crs.g_, x)
-	sec := &PoKSec{x, k, nt, m_}
+	_, _ = k.SetRandom()
+	_, _ = nt.SetRandom()
+	m_ := g2Mul(crs.g_, &x)
+	sec := &PoKSec{SecretScalar{&x}, SecretScalar{&k}, SecretScalar{&nt}, m_}
 
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, x), new(bls12381.G1Affine).ScalarMultiplication(crs.h, k))
-	V_ := new(bls12381.G2Affine).ScalarMultiplication(m_, nt)
-	X := new(bls12381.G1Affine).ScalarMultiplication(H, nt)
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, &x), g1Mul(crs.h, &k))
+	V_ := g2Mul(m_, &nt)
+	X := g1Mul(H, &nt)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -63,23 +61,22 @@ func BenchmarkPoKGen(b *testing.B) {
 
 func BenchmarkPoKVer(b *testing.B) {
 	_, _, g1, g2 := bls12381.Generators()
-	order := bls12381.ID.ScalarField()
 
 	crs := NewPoKCRS(&g1, getRandomG1(), &g2)
 	H := getRandomG1()
 
-	x, err := rand.Int(rand.Reader, order)
-	if err != nil {
+	var x, k, nt fr.Element
+	if _, err := x.SetRandom(); err != nil {
 		b.Fatal(err)
 	}
-	k, _ := rand.Int(rand.Reader, order)
-	nt, _ := rand.Int(rand.Reader, order)
-	m_ := new(bls12381.G2Affine).ScalarMultiplication(crs.g_, x)
-	sec := &PoKSec{x, k, nt, m_}
-
-	C := new(bls12381.G1Affine).Add(new(bls12381.G1Affine).ScalarMultiplication(crs.g, x), new(bls12381.G1Affine).ScalarMultiplication(crs.h, k))
-	V_ := new(bls12381.G2Affine).ScalarMultiplication(m_, nt)
-	X := new(bls12381.G1Affine).ScalarMultiplication(H, nt)
+	_, _ = k.SetRandom()
+	_, _ = nt.SetRandom()
+	m_ := g2Mul(crs.g_, &x)
+	sec := &PoKSec{SecretScalar{&x}, SecretScalar{&k}, SecretScalar{&nt}, m_}
+
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, &x), g1Mul(crs.h, &k))
+	V_ := g2Mul(m_, &nt)
+	X := g1Mul(H, &nt)
 
 	pkp, err := crs.GenPoKProof(sec, C, X, H, V_)
 	if err != nil {
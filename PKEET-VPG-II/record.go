@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"time"
+)
+
+// The PoK of a presentation carries X = H^nt and V_ = m_^nt with m_ = g_^x,
+// which is an RLight tag (ht, mt) under H. Once the proof verifies for the H of
+// an SP, its tag is what the SP stores and traceSP matches against the tokens
+// of the regulator.
+
+// RecordFromProof verifies pvp for the H of context and returns its tag
+func RecordFromProof(crs *CRS, keys EpochKeys, context []byte, pvp *PKEETVPGProof) (*RLight, error) {
+	if err := Verify(crs, keys, context, pvp); err != nil {
+		return nil, err
+	}
+	return recordOf(pvp.pkp)
+}
+
+func recordOf(pkp *PoKProof) (*RLight, error) {
+	if pkp.X == nil || pkp.V_ == nil {
+		return nil, errors.New("proof has no tracing tag")
+	}
+	ht := new(bls12381.G1Affine).Set(pkp.X)
+	mt := new(bls12381.G2Affine).Set(pkp.V_)
+	return &RLight{ht, mt}, nil
+}
+
+// AddProof verifies pvp for epoch, which must be fresh at now, and files its
+// tag under the epoch. It returns the position of the tag in the batch.
+func (er *EpochRecords) AddProof(crs *CRS, keys EpochKeys, epoch uint64, now time.Time, pvp *PKEETVPGProof) (int, error) {
+	if err := er.sched.Verify(crs, keys, epoch, now, pvp); err != nil {
+		return 0, err
+	}
+	rl, err := recordOf(pvp.pkp)
+	if err != nil {
+		return 0, err
+	}
+	if err = er.Add(epoch, rl); err != nil {
+		return 0, err
+	}
+	return len(er.batches[epoch].rec) - 1, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecordFromProof(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &PKECricuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkeCrs, _ := NewPKECRS()
+	pokCrs, _ := GenPoKCRS()
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sched := &HSchedule{SPID: "sp-a", Start: start, Period: time.Hour}
+	reg := NewSPRegistry()
+	assert.Nil(t, reg.Register(sched))
+	now := start.Add(90 * time.Minute)
+	e, H, _ := sched.Current(now)
+
+	pvp, err := user.Proof(crs, key.pk, 0, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := PublicKeyring{0: key.pk}
+	rl, err := RecordFromProof(crs, keys, sched.Context(e), pvp)
+	assert.Nil(t, err)
+	assert.True(t, rl.ht.Equal(pvp.pkp.X))
+	_, err = RecordFromProof(crs, keys, sched.Context(e+1), pvp)
+	assert.NotNil(t, err)
+
+	// the SP files the presentation next to unrelated records
+	er := NewEpochRecords(sched)
+	assert.Nil(t, er.Add(e, getRLight(getRandomG2(), H)))
+	i, err := er.AddProof(crs, keys, e, now, pvp)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, i)
+	_, err = er.AddProof(crs, keys, e, now.Add(2*time.Hour), pvp)
+	assert.NotNil(t, err)
+
+	// the token of m_ = g_^x finds it, that of another target does not
+	m_ := g2Mul(pokCrs.g_, x.element())
+	regulator := NewRegulator(reg)
+	tokens, _ := regulator.TraceTokens("sp-a", m_, []uint64{e})
+	refs, err := er.Trace(tokens)
+	assert.Nil(t, err)
+	assert.Equal(t, []RecordRef{{e, 1}}, refs)
+	tokens, _ = regulator.TraceTokens("sp-a", getRandomG2(), []uint64{e})
+	refs, err = er.Trace(tokens)
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+}
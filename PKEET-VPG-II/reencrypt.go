@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	twistededwards2 "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	twistededwards1 "github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"math/big"
+)
+
+// Re-encryption moves an archived ciphertext from a retired supervisor key to
+// its successor. The old key opens ct = (gj^v, m^v, W) and recovers v, and the
+// new ciphertext uses v' = a*v for a fresh random a, so that
+// (U', V') = (U^a, V^a). A DLEQ proof of log_U(U') = log_V(V') gives
+// V' = m^{v'} for the m of ct. The ReEncCricuit SNARK shows that W' masks v'
+// and some m' under Y' = pk^{v'}, with U' = gj^{v'}, V' = m'^{v'} and m' in the
+// prime-order subgroup, keeping Y', v' and m' private. Then m'^{v'} = m^{v'}
+// with v' != 0, so m' = m: what the new key opens is the m of ct. The DLEQ
+// challenge covers the target key and the epochs and W masks of both
+// ciphertexts, so none of them can be swapped after the fact. Payloads and
+// equality-test tags are not re-encrypted, so ciphertexts carrying one are
+// rejected.
+
+// ReEncCricuit proves that the ciphertext (U, V, W) under PK masks the nonce V
+// and m = (MX, MY) = [8]N with the private Y = PK^V. Writing m as a multiple of
+// the cofactor puts it in the prime-order subgroup.
+type ReEncCricuit struct {
+	V  frontend.Variable
+	MX frontend.Variable
+	MY frontend.Variable
+	NX frontend.Variable
+	NY frontend.Variable
+
+	PKX frontend.Variable `gnark:",public"`
+	PKY frontend.Variable `gnark:",public"`
+	UX  frontend.Variable `gnark:",public"`
+	UY  frontend.Variable `gnark:",public"`
+	VX  frontend.Variable `gnark:",public"`
+	VY  frontend.Variable `gnark:",public"`
+
+	W  frontend.Variable `gnark:",public"`
+	W1 frontend.Variable `gnark:",public"`
+	W2 frontend.Variable `gnark:",public"`
+
+	KID frontend.Variable `gnark:",public"`
+}
+
+// Positions of the public inputs of ReEncCricuit in its public witness
+const (
+	rpubPKX = 0
+	rpubUX  = 2
+	rpubW   = 6
+	rpubKID = 9
+)
+
+func (circuit *ReEncCricuit) Define(api frontend.API) error {
+	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
+	if err != nil {
+		panic(err)
+	}
+	base := twistededwards1.Point{
+		X: curve.Params().Base[0],
+		Y: curve.Params().Base[1],
+	}
+	PK := twistededwards1.Point{
+		X: circuit.PKX,
+		Y: circuit.PKY,
+	}
+	N := twistededwards1.Point{
+		X: circuit.NX,
+		Y: circuit.NY,
+	}
+	curve.AssertIsOnCurve(N)
+	m_ := curve.Double(curve.Double(curve.Double(N)))
+	api.AssertIsEqual(m_.X, circuit.MX)
+	api.AssertIsEqual(m_.Y, circuit.MY)
+
+	_, err = defineEnc(api, curve, base, m_, circuit.MX, circuit.MY, PK, &encVars{circuit.V, circuit.UX, circuit.UY, circuit.VX, circuit.VY, circuit.W, circuit.W1, circuit.W2, circuit.KID})
+	return err
+}
+
+// ReEncCRS is the CRS of ReEncrypt and VerifyReEncryption
+type ReEncCRS struct {
+	ccs constraint.ConstraintSystem
+	spk groth16.ProvingKey
+	svk groth16.VerifyingKey
+	*PKECRS
+}
+
+// SetupReEncryption compiles ReEncCricuit and runs the Groth16 setup for it
+func SetupReEncryption(crs *PKECRS) (*ReEncCRS, error) {
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &ReEncCricuit{})
+	if err != nil {
+		return nil, err
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		return nil, err
+	}
+	return &ReEncCRS{ccs, spk, svk, crs}, nil
+}
+
+// ReEncProof shows that two ciphertexts encrypt the same m
+type ReEncProof struct {
+	*DLEQProof
+
+	pubWit     witness.Witness
+	snarkProof groth16.Proof
+}
+
+// ReEncrypt opens ct with old and encrypts the plaintext again to pk under epoch
+func ReEncrypt(crs *ReEncCRS, ct *Ciphertext, old Decrypter, pk *twistededwards.PointAffine, epoch uint32) (*Ciphertext, *ReEncProof, error) {
+	if ct.Payload != nil {
+		return nil, nil, errors.New("cannot re-encrypt a ciphertext with a payload")
+	}
+	if ct.Tag != nil {
+		return nil, nil, errors.New("cannot re-encrypt a ciphertext with an equality-test tag")
+	}
+	for _, P := range []*twistededwards.PointAffine{ct.U, ct.V, pk} {
+		if err := checkJubjubPoint(P); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkMasks(ct); err != nil {
+		return nil, nil, err
+	}
+	Y, err := old.SharedPoint(ct.U)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, v, err := openWithY(crs.PKECRS, ct, Y)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipeElement(v)
+	vl := v.Bits()
+	defer wipeLimbs(&vl)
+	if ctLess(vl, jubjubOrder) == 0 {
+		return nil, nil, errors.New("ciphertext nonce is not reduced modulo the Jubjub order")
+	}
+
+	// a is nonzero so that (U', V') is not the identity
+	var al [4]uint64
+	defer wipeLimbs(&al)
+	for {
+		a, err := randJubjubScalar()
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
+		al = a.Bits()
+		zero := a.IsZero()
+		wipeElement(a)
+		if !zero {
+			break
+		}
+	}
+	vl_ := ctMulMod(vl, al, jubjubOrder)
+	defer wipeLimbs(&vl_)
+	v_ := frFromLimbs(vl_)
+	defer wipeElement(v_)
+
+	ct_, err := Enc(crs.PKECRS, pk, epoch, m, v_)
+	if err != nil {
+		return nil, nil, err
+	}
+	a := frFromLimbs(al)
+	defer wipeElement(a)
+	pf, err := proveDLEQ(reEncContext(ct, ct_, pk), ct.U, ct_.U, ct.V, ct_.V, a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// m is in the prime-order subgroup, so N = [8^-1]m has [8]N = m
+	curve := twistededwards.GetEdwardsCurve()
+	var inv fr.Element
+	inv.SetBigInt(new(big.Int).ModInverse(curve.Cofactor.BigInt(new(big.Int)), &curve.Order))
+	N := jubjubMul(m, &inv)
+	assignment := &ReEncCricuit{
+		V:   v_,
+		MX:  m.X,
+		MY:  m.Y,
+		NX:  N.X,
+		NY:  N.Y,
+		PKX: pk.X,
+		PKY: pk.Y,
+		UX:  ct_.U.X,
+		UY:  ct_.U.Y,
+		VX:  ct_.V.X,
+		VY:  ct_.V.Y,
+		W:   ct_.W[0],
+		W1:  ct_.W[1],
+		W2:  ct_.W[2],
+		KID: epoch,
+	}
+	secretWitness, err := frontend.NewWitness(assignment, ecc.BLS12_381.ScalarField())
+	if err != nil {
+		panic(err)
+	}
+	publicWitness, err := secretWitness.Public()
+	if err != nil {
+		panic(err)
+	}
+	snarkProof, err := groth16.Prove(crs.ccs, crs.spk, secretWitness)
+	wipeWitness(secretWitness)
+	if err != nil {
+		panic(err)
+	}
+	return ct_, &ReEncProof{pf, publicWitness, snarkProof}, nil
+}
+
+// checkMasks checks that the W masks of ct fit in 32 bytes, as Enc makes them
+func checkMasks(ct *Ciphertext) error {
+	for i := range ct.W {
+		if ct.W[i].Sign() < 0 || ct.W[i].BitLen() > 256 {
+			return errors.New("ciphertext mask is out of range")
+		}
+	}
+	return nil
+}
+
+// reEncContext is the transcript the DLEQ of a re-encryption is bound to. The
+// masks must have passed checkMasks.
+func reEncContext(ct, ct_ *Ciphertext, pk *twistededwards.PointAffine) []byte {
+	arr := []byte("PKEET-VPG/ReEnc")
+	arr = append(arr, pk.Marshal()...)
+	for _, c := range []*Ciphertext{ct, ct_} {
+		arr = binary.BigEndian.AppendUint32(arr, c.Epoch)
+		for i := range c.W {
+			w := BigIntToFixed32Bytes(&c.W[i])
+			arr = append(arr, w[:]...)
+		}
+	}
+	return arr
+}
+
+// VerifyReEncryption checks that ct_ holds the same m as ct and was made for
+// pk under its epoch
+func VerifyReEncryption(crs *ReEncCRS, ct, ct_ *Ciphertext, pk *twistededwards.PointAffine, proof *ReEncProof) error {
+	if proof == nil || proof.DLEQProof == nil || proof.pubWit == nil || proof.snarkProof == nil {
+		return errors.New("missing re-encryption proof")
+	}
+	if ct == nil || ct_ == nil || pk == nil {
+		return errors.New("re-encryption proof is invalid, missing ciphertext or key")
+	}
+	for _, P := range []*twistededwards.PointAffine{ct.U, ct.V, ct_.U, ct_.V, pk} {
+		if err := checkJubjubPoint(P); err != nil {
+			return fmt.Errorf("re-encryption proof is invalid: %w", err)
+		}
+	}
+	if ct.U.IsZero() || ct_.U.IsZero() {
+		return errors.New("re-encryption proof is invalid, identity nonce")
+	}
+	for _, c := range []*Ciphertext{ct, ct_} {
+		if err := checkMasks(c); err != nil {
+			return fmt.Errorf("re-encryption proof is invalid: %w", err)
+		}
+	}
+	if ct_.Payload != nil || ct_.Tag != nil {
+		return errors.New("re-encryption proof is invalid, payload or tag is not covered")
+	}
+	if err := verifyDLEQ(reEncContext(ct, ct_, pk), ct.U, ct_.U, ct.V, ct_.V, proof.DLEQProof); err != nil {
+		return fmt.Errorf("re-encryption proof is invalid: %w", err)
+	}
+
+	if err := groth16.Verify(proof.snarkProof, crs.svk, proof.pubWit); err != nil {
+		return errors.New("snark verification failed: " + err.Error())
+	}
+	pub, ok := proof.pubWit.Vector().(fr.Vector)
+	if !ok || len(pub) != rpubKID+1 {
+		return errors.New("malformed public witness")
+	}
+	if !pk.X.Equal(&pub[rpubPKX]) || !pk.Y.Equal(&pub[rpubPKX+1]) {
+		return errors.New("supervisor key does not match the snark statement")
+	}
+	return checkCtInputs(ct_, pub, rpubUX, rpubW, rpubKID)
+}
+
+// Migrate re-encrypts ct from its own epoch to the current epoch of kr
+func (kr *Keyring) Migrate(crs *ReEncCRS, ct *Ciphertext) (*Ciphertext, *ReEncProof, error) {
+	old, err := kr.Decrypter(ct.Epoch)
+	if err != nil {
+		return nil, nil, err
+	}
+	epoch, pk, err := kr.Current()
+	if err != nil {
+		return nil, nil, err
+	}
+	if epoch == ct.Epoch {
+		return nil, nil, fmt.Errorf("keyring: ciphertext is already under epoch %d", epoch)
+	}
+	return ReEncrypt(crs, ct, old, pk, epoch)
+}
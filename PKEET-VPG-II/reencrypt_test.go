@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestReEncrypt(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs, err := SetupReEncryption(&PKECRS{&curve.Base, getRandomG()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey := func() *Key {
+		sk, _ := RandSecretJubjub()
+		return &Key{sk, jubjubMul(crs.gj, sk.element())}
+	}
+	oldKey, newK := newKey(), newKey()
+
+	kr := NewKeyring()
+	assert.Nil(t, kr.Rotate(1, oldKey))
+
+	var cts []*Ciphertext
+	var ms []*twistededwards.PointAffine
+	for i := 0; i < 3; i++ {
+		x, _ := randJubjubScalar()
+		v, _ := randJubjubScalar()
+		m := jubjubMul(crs.gj, x)
+		ct, err := Enc(crs.PKECRS, oldKey.pk, 1, m, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cts = append(cts, ct)
+		ms = append(ms, m)
+	}
+
+	_, _, err = kr.Migrate(crs, cts[0])
+	assert.NotNil(t, err)
+	assert.Nil(t, kr.Rotate(2, newK))
+
+	var migrated []*Ciphertext
+	var proofs []*ReEncProof
+	for i, ct := range cts {
+		ct_, proof, err := kr.Migrate(crs, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint32(2), ct_.Epoch)
+		assert.Nil(t, VerifyReEncryption(crs, ct, ct_, newK.pk, proof))
+		migrated = append(migrated, ct_)
+		proofs = append(proofs, proof)
+
+		// the successor opens it alone
+		m_, err := Dec(crs.PKECRS, ct_, newK)
+		assert.Nil(t, err)
+		assert.Equal(t, ms[i], m_)
+	}
+	assert.Nil(t, kr.Retire(1))
+	m_, err := kr.Dec(crs.PKECRS, migrated[0])
+	assert.Nil(t, err)
+	assert.Equal(t, ms[0], m_)
+
+	// the proof does not transfer to another pair
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], migrated[1], newK.pk, proofs[0]))
+	assert.NotNil(t, VerifyReEncryption(crs, cts[1], migrated[1], newK.pk, proofs[0]))
+
+	// the masks, the epoch and the target key are bound to the proof
+	clone := func() *Ciphertext {
+		c := *migrated[0]
+		for i := range c.W {
+			c.W[i] = big.Int{}
+			c.W[i].Set(&migrated[0].W[i])
+		}
+		return &c
+	}
+	tampered := clone()
+	tampered.W[0].Add(&tampered.W[0], big.NewInt(1))
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], tampered, newK.pk, proofs[0]))
+	tampered = clone()
+	tampered.Epoch = 3
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], tampered, newK.pk, proofs[0]))
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], migrated[0], oldKey.pk, proofs[0]))
+	tampered = clone()
+	tampered.W[1].Lsh(&tampered.W[1], 300)
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], tampered, newK.pk, proofs[0]))
+	assert.Nil(t, VerifyReEncryption(crs, cts[0], migrated[0], newK.pk, proofs[0]))
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], nil, newK.pk, proofs[0]))
+
+	// a fresh encryption of another m under the new key is rejected
+	x, _ := randJubjubScalar()
+	v, _ := randJubjubScalar()
+	other, _ := Enc(crs.PKECRS, newK.pk, 2, jubjubMul(crs.gj, x), v)
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], other, newK.pk, proofs[0]))
+
+	// (U^3, V^3) passes the DLEQ, but its masks do not open to m
+	three := new(fr.Element).SetUint64(3)
+	forged := &Ciphertext{U: jubjubMul(cts[0].U, three), V: jubjubMul(cts[0].V, three), Epoch: 2}
+	forged.W[0].SetInt64(1)
+	forged.W[1].SetInt64(2)
+	forged.W[2].SetInt64(3)
+	pf, err := proveDLEQ(reEncContext(cts[0], forged, newK.pk), cts[0].U, forged.U, cts[0].V, forged.V, three)
+	assert.Nil(t, err)
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], forged, newK.pk, &ReEncProof{pf, proofs[0].pubWit, proofs[0].snarkProof}))
+	assert.NotNil(t, VerifyReEncryption(crs, cts[0], migrated[0], newK.pk, &ReEncProof{proofs[0].DLEQProof, nil, nil}))
+
+	// payloads and tags are not carried over
+	m := jubjubMul(crs.gj, x)
+	withPayload, _ := EncPayload(crs.PKECRS, oldKey.pk, 1, m, []fr.Element{*three}, v)
+	_, _, err = ReEncrypt(crs, withPayload, oldKey, newK.pk, 2)
+	assert.NotNil(t, err)
+	tagged, _ := EncTest(crs.PKECRS, oldKey.pk, oldKey.Trapdoor(crs.PKECRS).PublicKey(), 1, m, v)
+	_, _, err = ReEncrypt(crs, tagged, oldKey, newK.pk, 2)
+	assert.NotNil(t, err)
+
+	// re-encrypting needs the right old key
+	_, _, err = ReEncrypt(crs, cts[0], newK, newK.pk, 3)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"io"
+	"math/big"
+	"math/bits"
+)
+
+// Secret scalars are kept as fr.Element. Jubjub scalars live in [0, p) with p the
+// Jubjub subgroup order, which is smaller than the BLS12-381 scalar field modulus,
+// so the same type holds both. Arithmetic modulo p is done on the regular-form
+// limbs with the branch-free helpers below.
+
+// jubjubOrder is the order of the Jubjub prime subgroup as little-endian limbs
+var jubjubOrder = func() [4]uint64 {
+	curve := twistededwards.GetEdwardsCurve()
+	return bigToLimbs(&curve.Order)
+}()
+
+// frInvExp is r-2, used to invert in fr through Fermat's little theorem
+var frInvExp = new(big.Int).Sub(fr.Modulus(), big.NewInt(2))
+
+func bigToLimbs(n *big.Int) [4]uint64 {
+	var buf [32]byte
+	n.FillBytes(buf[:])
+	return bytesToLimbs(&buf)
+}
+
+func bytesToLimbs(b *[32]byte) [4]uint64 {
+	return [4]uint64{
+		binary.BigEndian.Uint64(b[24:32]),
+		binary.BigEndian.Uint64(b[16:24]),
+		binary.BigEndian.Uint64(b[8:16]),
+		binary.BigEndian.Uint64(b[0:8]),
+	}
+}
+
+func limbsToBytes(l [4]uint64) [32]byte {
+	var b [32]byte
+	binary.BigEndian.PutUint64(b[24:32], l[0])
+	binary.BigEndian.PutUint64(b[16:24], l[1])
+	binary.BigEndian.PutUint64(b[8:16], l[2])
+	binary.BigEndian.PutUint64(b[0:8], l[3])
+	return b
+}
+
+// limbsToBig converts limbs to a big.Int. Only use it for public values.
+func limbsToBig(l [4]uint64) *big.Int {
+	b := limbsToBytes(l)
+	return new(big.Int).SetBytes(b[:])
+}
+
+// frFromLimbs converts limbs holding a value below r to an fr.Element
+func frFromLimbs(l [4]uint64) *fr.Element {
+	b := limbsToBytes(l)
+	return new(fr.Element).SetBytes(b[:])
+}
+
+// randLimbs returns a uniform integer in [0, 2^n), n <= 256
+func randLimbs(n int) ([4]uint64, error) {
+	var buf [32]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		return [4]uint64{}, err
+	}
+	l := bytesToLimbs(&buf)
+	low, _ := splitLimbs(l, uint(n))
+	return low, nil
+}
+
+// randJubjubScalar returns a uniform scalar in [0, p) with p the Jubjub order
+func randJubjubScalar() (*fr.Element, error) {
+	curve := twistededwards.GetEdwardsCurve()
+	n := curve.Order.BitLen()
+	for {
+		l, err := randLimbs(n)
+		if err != nil {
+			return nil, err
+		}
+		if ctLess(l, jubjubOrder) == 1 {
+			return frFromLimbs(l), nil
+		}
+	}
+}
+
+// ctLess returns 1 if a < b and 0 otherwise
+func ctLess(a, b [4]uint64) uint64 {
+	var borrow uint64
+	for i := 0; i < 4; i++ {
+		_, borrow = bits.Sub64(a[i], b[i], borrow)
+	}
+	return borrow
+}
+
+// ctSelect returns b if c == 1 and a if c == 0
+func ctSelect(c uint64, a, b [4]uint64) [4]uint64 {
+	mask := -c
+	var z [4]uint64
+	for i := 0; i < 4; i++ {
+		z[i] = a[i] ^ (mask & (a[i] ^ b[i]))
+	}
+	return z
+}
+
+// ctAddMod returns a + b mod m for a, b < m
+func ctAddMod(a, b, m [4]uint64) [4]uint64 {
+	var s, d [4]uint64
+	var carry, borrow uint64
+	for i := 0; i < 4; i++ {
+		s[i], carry = bits.Add64(a[i], b[i], carry)
+	}
+	for i := 0; i < 4; i++ {
+		d[i], borrow = bits.Sub64(s[i], m[i], borrow)
+	}
+	// keep the reduced value if the sum overflowed or did not underflow
+	return ctSelect(carry|(borrow^1), s, d)
+}
+
+// ctMulSmallMod returns c * a mod m for a < m. The multiplier c is treated as
+// public and may be branched on; only a is handled in constant time.
+func ctMulSmallMod(a [4]uint64, c uint64, m [4]uint64) [4]uint64 {
+	return ctMulPubMod(a, [4]uint64{c}, m)
+}
+
+// ctMulPubMod returns c * a mod m for a < m and a public multiplier c
+func ctMulPubMod(a, c [4]uint64, m [4]uint64) [4]uint64 {
+	n := 0
+	for i := 3; i >= 0; i-- {
+		if c[i] != 0 {
+			n = 64*i + bits.Len64(c[i])
+			break
+		}
+	}
+	var acc [4]uint64
+	for i := n - 1; i >= 0; i-- {
+		acc = ctAddMod(acc, acc, m)
+		if (c[i/64]>>uint(i%64))&1 == 1 {
+			acc = ctAddMod(acc, a, m)
+		}
+	}
+	return acc
+}
+
+// ctMulMod returns a * b mod m for a, b < m, in constant time in both
+func ctMulMod(a, b, m [4]uint64) [4]uint64 {
+	var acc [4]uint64
+	for i := 255; i >= 0; i-- {
+		acc = ctAddMod(acc, acc, m)
+		bit := (b[i/64] >> uint(i%64)) & 1
+		acc = ctSelect(bit, acc, ctAddMod(acc, a, m))
+	}
+	return acc
+}
+
+// ctMulAddSmall returns the integer k + c * x and the carry out of 256 bits
+func ctMulAddSmall(k, x [4]uint64, c uint64) ([4]uint64, uint64) {
+	var z [4]uint64
+	var carry uint64
+	for i := 0; i < 4; i++ {
+		hi, lo := bits.Mul64(x[i], c)
+		var c0, c1 uint64
+		lo, c0 = bits.Add64(lo, carry, 0)
+		z[i], c1 = bits.Add64(lo, k[i], 0)
+		carry = hi + c0 + c1
+	}
+	return z, carry
+}
+
+// ctHighZero returns 1 if z >> n == 0 and 0 otherwise, for a public n
+func ctHighZero(z [4]uint64, n uint) uint64 {
+	_, high := splitLimbs(z, n)
+	acc := high[0] | high[1] | high[2] | high[3]
+	return ((acc | -acc) >> 63) ^ 1
+}
+
+// splitLimbs returns (l mod 2^n, l >> n) for a public bit position n
+func splitLimbs(l [4]uint64, n uint) (low, high [4]uint64) {
+	for i := uint(0); i < 4; i++ {
+		pos := i * 64
+		switch {
+		case pos+64 <= n:
+			low[i] = l[i]
+		case pos < n:
+			low[i] = l[i] & (1<<(n-pos) - 1)
+		}
+	}
+	w, b := n/64, n%64
+	for i := uint(0); i+w < 4; i++ {
+		high[i] = l[i+w] >> b
+		if b != 0 && i+w+1 < 4 {
+			high[i] |= l[i+w+1] << (64 - b)
+		}
+	}
+	return low, high
+}
+
+// jubjubMul returns [s]p for a secret scalar s
+func jubjubMul(p *twistededwards.PointAffine, s *fr.Element) *twistededwards.PointAffine {
+	l := s.Bits()
+	defer wipeLimbs(&l)
+	return jubjubMulLimbs(p, l)
+}
+
+// jubjubMulLimbs returns [s]p with a Montgomery ladder over all 256 bits of s.
+// The projective twisted Edwards formulas of gnark-crypto are complete on Jubjub,
+// so every step runs the same field operations whatever the bits of s are.
+func jubjubMulLimbs(p *twistededwards.PointAffine, s [4]uint64) *twistededwards.PointAffine {
+	var r0, r1 twistededwards.PointProj
+	r0.X.SetZero()
+	r0.Y.SetOne()
+	r0.Z.SetOne()
+	r1.FromAffine(p)
+
+	var swap uint64
+	for i := 255; i >= 0; i-- {
+		bit := (s[i/64] >> uint(i%64)) & 1
+		ctSwapProj(&r0, &r1, swap^bit)
+		swap = bit
+		r1.Add(&r0, &r1)
+		r0.Double(&r0)
+	}
+	ctSwapProj(&r0, &r1, swap)
+
+	var zInv fr.Element
+	zInv.Exp(r0.Z, frInvExp)
+	res := new(twistededwards.PointAffine)
+	res.X.Mul(&r0.X, &zInv)
+	res.Y.Mul(&r0.Y, &zInv)
+	return res
+}
+
+func ctSwapProj(a, b *twistededwards.PointProj, c uint64) {
+	var ta, tb twistededwards.PointProj
+	ta.X.Select(int(c), &a.X, &b.X)
+	ta.Y.Select(int(c), &a.Y, &b.Y)
+	ta.Z.Select(int(c), &a.Z, &b.Z)
+	tb.X.Select(int(c), &b.X, &a.X)
+	tb.Y.Select(int(c), &b.Y, &a.Y)
+	tb.Z.Select(int(c), &b.Z, &a.Z)
+	*a, *b = ta, tb
+}
+
+// g1Mul returns [s]p in G1. gnark-crypto offers no constant-time G1/G2
+// multiplication, so this goes through its GLV routine.
+func g1Mul(p *bls12381.G1Affine, s *fr.Element) *bls12381.G1Affine {
+	n := s.BigInt(new(big.Int))
+	defer wipeBig(n)
+	return new(bls12381.G1Affine).ScalarMultiplication(p, n)
+}
+
+// g2Mul returns [s]p in G2, see g1Mul
+func g2Mul(p *bls12381.G2Affine, s *fr.Element) *bls12381.G2Affine {
+	n := s.BigInt(new(big.Int))
+	defer wipeBig(n)
+	return new(bls12381.G2Affine).ScalarMultiplication(p, n)
+}
+
+// frResponse returns the public Schnorr response r + c * s as a big.Int
+func frResponse(r, c, s *fr.Element) *big.Int {
+	var z fr.Element
+	z.Mul(c, s).Add(&z, r)
+	return z.BigInt(new(big.Int))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/rand"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestJubjubMul(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	p := getRandomG()
+	for i := 0; i < 5; i++ {
+		s, err := randJubjubScalar()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, s.BigInt(new(big.Int)).Cmp(&curve.Order) < 0)
+		want := new(twistededwards.PointAffine).ScalarMultiplication(p, s.BigInt(new(big.Int)))
+		assert.True(t, want.Equal(jubjubMul(p, s)))
+	}
+
+	// scalars beyond the group order and the zero scalar
+	l, _ := randLimbs(256)
+	want := new(twistededwards.PointAffine).ScalarMultiplication(p, limbsToBig(l))
+	assert.True(t, want.Equal(jubjubMulLimbs(p, l)))
+	zero := jubjubMulLimbs(p, [4]uint64{})
+	assert.True(t, zero.IsZero())
+}
+
+func TestCtLimbArithmetic(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	p := &curve.Order
+	for i := 0; i < 20; i++ {
+		a, _ := rand.Int(rand.Reader, p)
+		b, _ := rand.Int(rand.Reader, p)
+		cb, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+		c := cb.Uint64()
+
+		sum := new(big.Int).Mod(new(big.Int).Add(a, b), p)
+		assert.Equal(t, 0, sum.Cmp(limbsToBig(ctAddMod(bigToLimbs(a), bigToLimbs(b), jubjubOrder))))
+
+		prod := new(big.Int).Mod(new(big.Int).Mul(a, cb), p)
+		assert.Equal(t, 0, prod.Cmp(limbsToBig(ctMulSmallMod(bigToLimbs(a), c, jubjubOrder))))
+
+		prod.Mod(new(big.Int).Mul(a, b), p)
+		assert.Equal(t, 0, prod.Cmp(limbsToBig(ctMulMod(bigToLimbs(a), bigToLimbs(b), jubjubOrder))))
+
+		x, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		z, carry := ctMulAddSmall(bigToLimbs(b), bigToLimbs(x), c)
+		want := new(big.Int).Add(b, new(big.Int).Mul(x, cb))
+		assert.Equal(t, uint64(0), carry)
+		assert.Equal(t, 0, want.Cmp(limbsToBig(z)))
+
+		less := uint64(0)
+		if a.Cmp(b) < 0 {
+			less = 1
+		}
+		assert.Equal(t, less, ctLess(bigToLimbs(a), bigToLimbs(b)))
+	}
+}
+
+func TestSplitLimbs(t *testing.T) {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 256))
+	for _, k := range []uint{0, 60, 64, 128, 192, 200, 256} {
+		low, high := splitLimbs(bigToLimbs(n), k)
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), k), big.NewInt(1))
+		assert.Equal(t, 0, new(big.Int).And(n, mask).Cmp(limbsToBig(low)))
+		assert.Equal(t, 0, new(big.Int).Rsh(n, k).Cmp(limbsToBig(high)))
+	}
+	assert.Equal(t, uint64(1), ctHighZero([4]uint64{1 << 10}, 11))
+	assert.Equal(t, uint64(0), ctHighZero([4]uint64{1 << 10}, 10))
+}
+
+func BenchmarkJubjubMul(b *testing.B) {
+	p := getRandomG()
+	s, _ := randJubjubScalar()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = jubjubMul(p, s)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"sort"
+	"time"
+)
+
+// An HSchedule ties the variable public generator of a service provider to
+// time: epoch e covers [Start + e*Period, Start + (e+1)*Period) and uses
+// H_e = HashToG1(spID || e). Provers derive the H of the current epoch, and the
+// SP files each record under the epoch of its proof, so one trace token per
+// epoch covers all of its records. These generator epochs are unrelated to the
+// key epochs of supervisor keyrings.
+type HSchedule struct {
+	SPID   string
+	Start  time.Time
+	Period time.Duration
+	// Grace is how many past epochs verifiers still accept
+	Grace uint64
+}
+
+// benchSchedule is the schedule of the simulated service provider of
+// GenerateRecordsLight, whose batch i holds the records of epoch i
+var benchSchedule = &HSchedule{SPID: "sp-0", Period: time.Hour}
+
+// batchContext is the context of the H of batch i of the simulated provider
+func batchContext(i int) []byte {
+	return benchSchedule.Context(uint64(i))
+}
+
+// EpochAt returns the epoch in force at t
+func (s *HSchedule) EpochAt(t time.Time) (uint64, error) {
+	if s.Period <= 0 {
+		return 0, errors.New("schedule period must be positive")
+	}
+	if t.Before(s.Start) {
+		return 0, errors.New("time is before the start of the schedule")
+	}
+	return uint64(t.Sub(s.Start) / s.Period), nil
+}
+
+// Context returns spID || e, with e as 8 big-endian bytes
+func (s *HSchedule) Context(epoch uint64) []byte {
+	ctx := make([]byte, len(s.SPID)+8)
+	copy(ctx, s.SPID)
+	binary.BigEndian.PutUint64(ctx[len(s.SPID):], epoch)
+	return ctx
+}
+
+// H returns H_e
+func (s *HSchedule) H(epoch uint64) (*bls12381.G1Affine, error) {
+	return DeriveH(s.Context(epoch))
+}
+
+// Current returns the epoch in force at now and its H
+func (s *HSchedule) Current(now time.Time) (uint64, *bls12381.G1Affine, error) {
+	epoch, err := s.EpochAt(now)
+	if err != nil {
+		return 0, nil, err
+	}
+	H, err := s.H(epoch)
+	if err != nil {
+		return 0, nil, err
+	}
+	return epoch, H, nil
+}
+
+// checkFresh rejects epochs older than Grace epochs before now, and future ones
+func (s *HSchedule) checkFresh(epoch uint64, now time.Time) error {
+	current, err := s.EpochAt(now)
+	if err != nil {
+		return err
+	}
+	if epoch > current {
+		return fmt.Errorf("epoch %d has not started, current epoch is %d", epoch, current)
+	}
+	if current-epoch > s.Grace {
+		return fmt.Errorf("epoch %d is stale, current epoch is %d", epoch, current)
+	}
+	return nil
+}
+
+// Verify checks pvp as a proof for epoch, which must still be fresh at now
+func (s *HSchedule) Verify(crs *CRS, keys EpochKeys, epoch uint64, now time.Time, pvp *PKEETVPGProof) error {
+	if err := s.checkFresh(epoch, now); err != nil {
+		return err
+	}
+	return Verify(crs, keys, s.Context(epoch), pvp)
+}
+
+// EpochRecords collects the records of a service provider into one RBatch per
+// epoch of its schedule
+type EpochRecords struct {
+	sched   *HSchedule
+	batches map[uint64]*RBatch
+}
+
+func NewEpochRecords(sched *HSchedule) *EpochRecords {
+	return &EpochRecords{sched, make(map[uint64]*RBatch)}
+}
+
+// Add files rl under epoch, creating the batch of the epoch on first use
+func (er *EpochRecords) Add(epoch uint64, rl *RLight) error {
+	b, ok := er.batches[epoch]
+	if !ok {
+		ctx := er.sched.Context(epoch)
+		h, err := DeriveH(ctx)
+		if err != nil {
+			return err
+		}
+		b = &RBatch{ctx: ctx, h: h}
+		er.batches[epoch] = b
+	}
+	b.rec = append(b.rec, rl)
+	return nil
+}
+
+// Batches returns the batches in increasing epoch order, indexed from 0 as
+// traceR1 and traceSP expect, and the epoch of each index
+func (er *EpochRecords) Batches() (map[int]*RBatch, []uint64) {
+	epochs := make([]uint64, 0, len(er.batches))
+	for e := range er.batches {
+		epochs = append(epochs, e)
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	groups := make(map[int]*RBatch, len(epochs))
+	for i, e := range epochs {
+		groups[i] = er.batches[e]
+	}
+	return groups, epochs
+}
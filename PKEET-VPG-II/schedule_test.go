@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHSchedule(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sched := &HSchedule{SPID: "sp-1", Start: start, Period: time.Hour, Grace: 1}
+
+	e, err := sched.EpochAt(start.Add(150 * time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), e)
+	_, err = sched.EpochAt(start.Add(-time.Second))
+	assert.NotNil(t, err)
+
+	// H_e depends on the SP and the epoch
+	H2, _ := sched.H(2)
+	H2_, _ := DeriveH(sched.Context(2))
+	H3, _ := sched.H(3)
+	other, _ := (&HSchedule{SPID: "sp-2", Period: time.Hour}).H(2)
+	assert.True(t, H2.Equal(H2_))
+	assert.False(t, H2.Equal(H3))
+	assert.False(t, H2.Equal(other))
+
+	now := start.Add(3*time.Hour + time.Minute)
+	e, H, err := sched.Current(now)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), e)
+	assert.True(t, H.Equal(H3))
+	assert.Nil(t, sched.checkFresh(3, now))
+	assert.Nil(t, sched.checkFresh(2, now))
+	assert.NotNil(t, sched.checkFresh(1, now))
+	assert.NotNil(t, sched.checkFresh(4, now))
+}
+
+func TestEpochRecords(t *testing.T) {
+	sched := &HSchedule{SPID: "sp-1", Period: time.Hour}
+	m := getRandomG2()
+	er := NewEpochRecords(sched)
+	for _, e := range []uint64{7, 3, 7, 5, 3, 7} {
+		h, _ := sched.H(e)
+		assert.Nil(t, er.Add(e, getRLight(m, h)))
+		assert.Nil(t, er.Add(e, getRLight(getRandomG2(), h)))
+	}
+	groups, epochs := er.Batches()
+	assert.Equal(t, []uint64{3, 5, 7}, epochs)
+	assert.Equal(t, 4, len(groups[0].rec))
+	assert.Equal(t, 2, len(groups[1].rec))
+	assert.Equal(t, 6, len(groups[2].rec))
+	for _, b := range groups {
+		assert.Nil(t, b.Audit())
+	}
+
+	// one token per epoch finds the records of m
+	match, err := traceSP(groups, traceR1(groups, m))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 2, 4, 6, 8, 10}, match)
+}
+
+func TestPKEETVPGScheduled(t *testing.T) {
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &PKECricuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkeCrs, _ := NewPKECRS()
+	pokCrs, _ := GenPoKCRS()
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sched := &HSchedule{SPID: "sp-1", Start: start, Period: time.Hour}
+	now := start.Add(5*time.Hour + time.Minute)
+	e, H, err := sched.Current(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvp, err := user.Proof(crs, key.pk, 0, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := PublicKeyring{0: key.pk}
+	assert.Nil(t, sched.Verify(crs, keys, e, now, pvp))
+
+	// the proof is stale once the epoch is over, and not valid for another one
+	assert.NotNil(t, sched.Verify(crs, keys, e, now.Add(time.Hour), pvp))
+	assert.NotNil(t, sched.Verify(crs, keys, e+1, now.Add(time.Hour), pvp))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"io"
+	"math/big"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretScalar holds a long-term secret scalar such as a supervisor key or a
+// user opening. It never prints or marshals its value, and Destroy zeroes the
+// limbs. Copies of a SecretScalar share the same limbs.
+type SecretScalar struct {
+	e *fr.Element
+}
+
+// NewSecretScalar copies e into a new SecretScalar
+func NewSecretScalar(e *fr.Element) SecretScalar {
+	s := SecretScalar{new(fr.Element)}
+	s.e.Set(e)
+	return s
+}
+
+// RandSecretJubjub returns a secret uniform in [0, p) with p the Jubjub order
+func RandSecretJubjub() (SecretScalar, error) {
+	e, err := randJubjubScalar()
+	if err != nil {
+		return SecretScalar{}, err
+	}
+	return SecretScalar{e}, nil
+}
+
+// RandSecretFr returns a secret uniform in [0, r) with r the BLS12-381 order
+func RandSecretFr() (SecretScalar, error) {
+	e := new(fr.Element)
+	if _, err := e.SetRandom(); err != nil {
+		return SecretScalar{}, err
+	}
+	return SecretScalar{e}, nil
+}
+
+// element exposes the limbs to the package. A destroyed or zero-value
+// SecretScalar reads as zero.
+func (s SecretScalar) element() *fr.Element {
+	if s.e == nil {
+		return new(fr.Element)
+	}
+	return s.e
+}
+
+// Destroy zeroes the limbs of s and of every copy of it
+func (s SecretScalar) Destroy() {
+	if s.e != nil {
+		wipeElement(s.e)
+	}
+}
+
+func (s SecretScalar) String() string {
+	return "SecretScalar(" + redacted + ")"
+}
+
+func (s SecretScalar) GoString() string {
+	return s.String()
+}
+
+// Format makes every fmt verb print the redacted form
+func (s SecretScalar) Format(f fmt.State, _ rune) {
+	_, _ = io.WriteString(f, s.String())
+}
+
+func (s SecretScalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+func (sec PoKSec) String() string {
+	return "PoKSec(" + redacted + ")"
+}
+
+func (sec PoKSec) GoString() string {
+	return sec.String()
+}
+
+func (sec PoKSec) Format(f fmt.State, _ rune) {
+	_, _ = io.WriteString(f, sec.String())
+}
+
+func (sec PoKSec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// Destroy zeroes the secrets of sec, including the ones it shares with the
+// PKEETVPG it was built from
+func (sec *PoKSec) Destroy() {
+	sec.x.Destroy()
+	sec.k.Destroy()
+	sec.t.Destroy()
+	if sec.m_ != nil {
+		sec.m_.X.SetZero()
+		sec.m_.Y.SetZero()
+	}
+}
+
+// Destroy zeroes the supervisor secret key
+func (key *Key) Destroy() {
+	key.sk.Destroy()
+}
+
+// Destroy zeroes the user opening (x, k) of C
+func (pv *PKEETVPG) Destroy() {
+	pv.x.Destroy()
+	pv.k.Destroy()
+}
+
+func wipeElement(e *fr.Element) {
+	for i := range e {
+		e[i] = 0
+	}
+}
+
+func wipeLimbs(l *[4]uint64) {
+	for i := range l {
+		l[i] = 0
+	}
+}
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeWitness zeroes a full witness once the SNARK proof has been computed.
+// Public witnesses are copies and are left untouched.
+func wipeWitness(w witness.Witness) {
+	if vec, ok := w.Vector().(fr.Vector); ok {
+		for i := range vec {
+			wipeElement(&vec[i])
+		}
+	}
+}
+
+// wipeBig zeroes the words of a temporary big.Int that held a secret
+func wipeBig(n *big.Int) {
+	w := n.Bits()
+	for i := range w {
+		w[i] = 0
+	}
+	n.SetInt64(0)
+}
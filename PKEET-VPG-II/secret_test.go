@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSecretScalarRedaction(t *testing.T) {
+	sk, err := RandSecretJubjub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	val := sk.element().String()
+	hex := sk.element().Text(16)
+
+	key := &Key{sk, jubjubMul(getRandomG(), sk.element())}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%d", "%x", "%q"} {
+		for _, arg := range []interface{}{sk, &sk, key, *key} {
+			out := fmt.Sprintf(verb, arg)
+			assert.NotContains(t, out, val, verb)
+			assert.NotContains(t, out, hex, verb)
+		}
+	}
+	assert.Equal(t, "SecretScalar([REDACTED])", sk.String())
+
+	js, err := json.Marshal(struct{ Sk SecretScalar }{sk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"Sk":"[REDACTED]"}`, string(js))
+}
+
+func TestPoKSecRedaction(t *testing.T) {
+	_, _, _, g2 := bls12381.Generators()
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	nt, _ := RandSecretFr()
+	sec := &PoKSec{x, k, nt, g2Mul(&g2, x.element())}
+
+	// a PoKSec value is redacted like a pointer to one
+	for _, v := range []any{sec, *sec} {
+		for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%d"} {
+			out := fmt.Sprintf(verb, v)
+			assert.True(t, strings.Contains(out, redacted), verb)
+			assert.NotContains(t, out, x.element().String(), verb)
+		}
+		assert.Equal(t, "PoKSec("+redacted+")", fmt.Sprint(v))
+		js, _ := json.Marshal(v)
+		assert.Equal(t, `"[REDACTED]"`, string(js))
+	}
+}
+
+func TestSecretScalarDestroy(t *testing.T) {
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	user := &PKEETVPG{x, k, nil}
+	cp := x
+	assert.False(t, cp.element().IsZero())
+
+	user.Destroy()
+	assert.True(t, x.element().IsZero())
+	assert.True(t, cp.element().IsZero())
+	assert.True(t, k.element().IsZero())
+
+	// zero-value secrets can be destroyed and read as zero
+	var empty SecretScalar
+	empty.Destroy()
+	assert.True(t, empty.element().IsZero())
+}
+
+func TestGenPoKProofKeepsLongTermSecrets(t *testing.T) {
+	_, _, g1, g2 := bls12381.Generators()
+	crs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	H := getRandomG1()
+
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	nt, _ := RandSecretFr()
+	xv, kv := *x.element(), *k.element()
+	m_ := g2Mul(crs.g_, x.element())
+	sec := &PoKSec{x, k, nt, m_}
+
+	C := new(bls12381.G1Affine).Add(g1Mul(crs.g, x.element()), g1Mul(crs.h, k.element()))
+	pkp, err := crs.GenPoKProof(sec, C, g1Mul(H, nt.element()), H, g2Mul(m_, nt.element()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, crs.VerPoKProof(pkp))
+	assert.True(t, xv.Equal(x.element()))
+	assert.True(t, kv.Equal(k.element()))
+
+	sec.Destroy()
+	assert.True(t, x.element().IsZero())
+	assert.True(t, m_.X.IsZero())
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	twistededwards2 "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	twistededwards1 "github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"github.com/consensys/gnark/std/hash/mimc"
+)
+
+// A SupervisorSet is the list of approved supervisor keys of a regulator,
+// committed to by a MiMC Merkle tree with leaves MiMC(pk.X, pk.Y). A user
+// encrypts to one of them and proves in SetPKECricuit that the key is a leaf
+// under the public root, with the key, Y and the path kept secret. Verifiers
+// only need the root, and ciphertexts do not reveal the chosen key, so each
+// supervisor tries its own key on a ciphertext.
+type SupervisorSet struct {
+	pks   []*twistededwards.PointAffine
+	nodes [][]fr.Element // nodes[0] are the leaves, nodes[depth] the root
+}
+
+// NewSupervisorSet builds a tree of the given depth over pks. Unused leaves are
+// zero, which is not the hash of any known key.
+func NewSupervisorSet(pks []*twistededwards.PointAffine, depth int) (*SupervisorSet, error) {
+	if depth < 1 || depth > 32 || len(pks) == 0 || len(pks) > 1<<depth {
+		return nil, fmt.Errorf("cannot fit %d keys in a tree of depth %d", len(pks), depth)
+	}
+	set := &SupervisorSet{pks: pks, nodes: make([][]fr.Element, depth+1)}
+	set.nodes[0] = make([]fr.Element, 1<<depth)
+	for i, pk := range pks {
+		if err := checkJubjubPoint(pk); err != nil {
+			return nil, fmt.Errorf("supervisor %d: %w", i, err)
+		}
+		set.nodes[0][i] = mimcElements(&pk.X, &pk.Y)
+	}
+	for l := 1; l <= depth; l++ {
+		below := set.nodes[l-1]
+		set.nodes[l] = make([]fr.Element, len(below)/2)
+		for i := range set.nodes[l] {
+			set.nodes[l][i] = mimcElements(&below[2*i], &below[2*i+1])
+		}
+	}
+	return set, nil
+}
+
+func (set *SupervisorSet) Root() fr.Element {
+	return set.nodes[len(set.nodes)-1][0]
+}
+
+func (set *SupervisorSet) Depth() int {
+	return len(set.nodes) - 1
+}
+
+func (set *SupervisorSet) PublicKey(i int) *twistededwards.PointAffine {
+	return set.pks[i]
+}
+
+// path returns the siblings of leaf i from the bottom up, and the direction
+// bits, 1 where the current node is a right child
+func (set *SupervisorSet) path(i int) ([]fr.Element, []uint64) {
+	siblings := make([]fr.Element, set.Depth())
+	dirs := make([]uint64, set.Depth())
+	for l := 0; l < set.Depth(); l++ {
+		siblings[l] = set.nodes[l][i^1]
+		dirs[l] = uint64(i & 1)
+		i >>= 1
+	}
+	return siblings, dirs
+}
+
+func mimcElements(es ...*fr.Element) fr.Element {
+	hFunc := hash.MIMC_BLS12_381.New()
+	for _, e := range es {
+		b := e.Bytes()
+		hFunc.Write(b[:])
+	}
+	var res fr.Element
+	res.SetBytes(hFunc.Sum(nil))
+	return res
+}
+
+// SetPKECricuit is PKECricuit with the supervisor key hidden in a Merkle tree
+// of depth len(Path). Y is not an input, so only the holder of the chosen key
+// can recompute the masks.
+type SetPKECricuit struct {
+	V   frontend.Variable
+	X   frontend.Variable
+	S   frontend.Variable
+	MX  frontend.Variable
+	MY  frontend.Variable
+	PKX frontend.Variable
+	PKY frontend.Variable
+
+	Path []frontend.Variable
+	Dirs []frontend.Variable
+
+	HX frontend.Variable `gnark:",public"`
+	HY frontend.Variable `gnark:",public"`
+
+	Root frontend.Variable `gnark:",public"`
+
+	UX frontend.Variable `gnark:",public"`
+	UY frontend.Variable `gnark:",public"`
+	VX frontend.Variable `gnark:",public"`
+	VY frontend.Variable `gnark:",public"`
+
+	W  frontend.Variable `gnark:",public"`
+	W1 frontend.Variable `gnark:",public"`
+	W2 frontend.Variable `gnark:",public"`
+
+	KID frontend.Variable `gnark:",public"`
+
+	BX frontend.Variable `gnark:",public"`
+	BY frontend.Variable `gnark:",public"`
+}
+
+// NewSetPKECricuit returns a circuit for trees of the given depth, ready to compile
+func NewSetPKECricuit(depth int) *SetPKECricuit {
+	return &SetPKECricuit{Path: make([]frontend.Variable, depth), Dirs: make([]frontend.Variable, depth)}
+}
+
+// Positions of the public inputs of SetPKECricuit in its public witness
+const (
+	spubHX   = 0
+	spubRoot = 2
+	spubUX   = 3
+	spubW    = 7
+	spubKID  = 10
+	spubBX   = 11
+	spubBY   = 12
+)
+
+func (circuit *SetPKECricuit) Define(api frontend.API) error {
+	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
+	if err != nil {
+		panic(err)
+	}
+	base := twistededwards1.Point{
+		X: curve.Params().Base[0],
+		Y: curve.Params().Base[1],
+	}
+	H := twistededwards1.Point{
+		X: circuit.HX,
+		Y: circuit.HY,
+	}
+	PK := twistededwards1.Point{
+		X: circuit.PKX,
+		Y: circuit.PKY,
+	}
+
+	// pk is a leaf under Root
+	miMC, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	miMC.Write(circuit.PKX, circuit.PKY)
+	node := miMC.Sum()
+	for i := range circuit.Path {
+		api.AssertIsBoolean(circuit.Dirs[i])
+		left := api.Select(circuit.Dirs[i], circuit.Path[i], node)
+		right := api.Select(circuit.Dirs[i], node, circuit.Path[i])
+		miMC.Reset()
+		miMC.Write(left, right)
+		node = miMC.Sum()
+	}
+	api.AssertIsEqual(node, circuit.Root)
+
+	m_ := curve.ScalarMul(base, circuit.X)
+	api.AssertIsEqual(m_.X, circuit.MX)
+	api.AssertIsEqual(m_.Y, circuit.MY)
+
+	_, err = defineEnc(api, curve, base, m_, circuit.MX, circuit.MY, PK, &encVars{circuit.V, circuit.UX, circuit.UY, circuit.VX, circuit.VY, circuit.W, circuit.W1, circuit.W2, circuit.KID})
+	if err != nil {
+		return err
+	}
+
+	ind2 := curve.ScalarMul(H, circuit.S)
+	B_ := curve.Add(m_, ind2)
+	api.AssertIsEqual(B_.X, circuit.BX)
+	api.AssertIsEqual(B_.Y, circuit.BY)
+
+	return nil
+}
+
+type PKEETVPGSetProof struct {
+	Root  fr.Element
+	Epoch uint32
+	B     *twistededwards.PointAffine
+	ct    *Ciphertext
+
+	pubWit     witness.Witness
+	snarkProof groth16.Proof
+
+	pkp *PoKProof
+	cgp []*CGProof
+}
+
+// ProofSet encrypts m = gj^x to supervisor i of set and proves that the key is
+// in the set without saying which. crs must be set up for SetPKECricuit with
+// the depth of set. The epoch is shared by the whole set.
+func (pv *PKEETVPG) ProofSet(crs *CRS, set *SupervisorSet, i int, epoch uint32, H *bls12381.G1Affine) (*PKEETVPGSetProof, error) {
+	if i < 0 || i >= len(set.pks) {
+		return nil, errors.New("supervisor index out of range")
+	}
+	pk := set.pks[i]
+
+	// ephemeral nonces, wiped once the proof is done
+	var v, s fr.Element
+	defer wipeElement(&v)
+	defer wipeElement(&s)
+
+	// 0. Encrypt
+	r, err := randJubjubScalar()
+	if err != nil {
+		return nil, err
+	}
+	v.Set(r)
+	wipeElement(r)
+	m := jubjubMul(crs.gj, pv.x.element())
+	ct, err := Enc(crs.PKECRS, pk, epoch, m, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. zkSNARKs
+	r, err = randJubjubScalar()
+	if err != nil {
+		return nil, err
+	}
+	s.Set(r)
+	wipeElement(r)
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, &s))
+	siblings, dirs := set.path(i)
+	assignment := NewSetPKECricuit(set.Depth())
+	for l := range siblings {
+		assignment.Path[l] = siblings[l]
+		assignment.Dirs[l] = dirs[l]
+	}
+	assignment.V = &v
+	assignment.X = pv.x.element()
+	assignment.S = &s
+	assignment.MX, assignment.MY = m.X, m.Y
+	assignment.PKX, assignment.PKY = pk.X, pk.Y
+	assignment.HX, assignment.HY = crs.hj.X, crs.hj.Y
+	assignment.Root = set.Root()
+	assignment.UX, assignment.UY = ct.U.X, ct.U.Y
+	assignment.VX, assignment.VY = ct.V.X, ct.V.Y
+	assignment.W, assignment.W1, assignment.W2 = ct.W[0], ct.W[1], ct.W[2]
+	assignment.KID = epoch
+	assignment.BX, assignment.BY = B.X, B.Y
+
+	secretWitness, err := frontend.NewWitness(assignment, ecc.BLS12_381.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	publicWitness, err := secretWitness.Public()
+	if err != nil {
+		return nil, err
+	}
+	snarkProof, err := groth16.Prove(crs.ccs, crs.spk, secretWitness)
+	wipeWitness(secretWitness)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. PoK and 3. CGPoK
+	pkp, cgp, err := pv.proveOpening(crs, &s, H)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKEETVPGSetProof{
+		Root:       set.Root(),
+		Epoch:      epoch,
+		B:          B,
+		ct:         ct,
+		pubWit:     publicWitness,
+		snarkProof: snarkProof,
+		pkp:        pkp,
+		cgp:        cgp,
+	}, nil
+}
+
+// VerifySet checks a proof against the root of the approved set and the H of
+// context
+func VerifySet(crs *CRS, context []byte, root *fr.Element, pvp *PKEETVPGSetProof) error {
+	if pvp == nil || pvp.B == nil || pvp.ct == nil || pvp.pubWit == nil || pvp.snarkProof == nil || pvp.pkp == nil {
+		return errors.New("malformed proof")
+	}
+	if root == nil {
+		return errors.New("missing supervisor set root")
+	}
+	// 1. zkSNARKs verify
+	err := groth16.Verify(pvp.snarkProof, crs.svk, pvp.pubWit)
+	if err != nil {
+		return errors.New("snark verification failed: " + err.Error())
+	}
+	pub, ok := pvp.pubWit.Vector().(fr.Vector)
+	if !ok || len(pub) != spubBY+1 {
+		return errors.New("malformed public witness")
+	}
+	if !crs.hj.X.Equal(&pub[spubHX]) || !crs.hj.Y.Equal(&pub[spubHX+1]) {
+		return errors.New("hj does not match the snark statement")
+	}
+	if !pub[spubRoot].Equal(root) || !pvp.Root.Equal(root) {
+		return errors.New("supervisor set root does not match the snark statement")
+	}
+	if err = checkCtInputs(pvp.ct, pub, spubUX, spubW, spubKID); err != nil {
+		return err
+	}
+	if err = checkNoTag(pvp.ct); err != nil {
+		return err
+	}
+	if pvp.ct.Epoch != pvp.Epoch {
+		return errors.New("key epoch does not match the snark statement")
+	}
+	if !pvp.B.X.Equal(&pub[spubBX]) || !pvp.B.Y.Equal(&pub[spubBY]) {
+		return errors.New("B does not match the snark statement")
+	}
+
+	return verifyOpening(crs, context, pvp.B, pvp.pkp, pvp.cgp)
+}
+
+// Ciphertext returns the encryption of m proven by pvp. Only the chosen
+// supervisor can open it.
+func (pvp *PKEETVPGSetProof) Ciphertext() *Ciphertext {
+	return pvp.ct
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSupervisorSet(t *testing.T) {
+	var pks []*twistededwards.PointAffine
+	for i := 0; i < 5; i++ {
+		pks = append(pks, getRandomG())
+	}
+	set, err := NewSupervisorSet(pks, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every path leads to the root
+	for i, pk := range pks {
+		node := mimcElements(&pk.X, &pk.Y)
+		siblings, dirs := set.path(i)
+		for l := range siblings {
+			if dirs[l] == 1 {
+				node = mimcElements(&siblings[l], &node)
+			} else {
+				node = mimcElements(&node, &siblings[l])
+			}
+		}
+		root := set.Root()
+		assert.True(t, node.Equal(&root))
+	}
+
+	// the root commits to the order and content of the set
+	other, _ := NewSupervisorSet(append([]*twistededwards.PointAffine{pks[1], pks[0]}, pks[2:]...), 3)
+	r1, r2 := set.Root(), other.Root()
+	assert.False(t, r1.Equal(&r2))
+
+	_, err = NewSupervisorSet(pks, 2)
+	assert.NotNil(t, err)
+}
+
+func TestPKEETVPGSet(t *testing.T) {
+	// 1. Setup for sets of up to 4 supervisors
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, NewSetPKECricuit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	pkeCrs := &PKECRS{&curve.Base, getRandomG()}
+	_, _, g1, g2 := bls12381.Generators()
+	pokCrs := NewPoKCRS(&g1, getRandomG1(), &g2)
+	crs := &CRS{ccs, spk, svk, pkeCrs, pokCrs}
+	ctxH := batchContext(0)
+	H, _ := DeriveH(ctxH)
+
+	var keys []*Key
+	var pks []*twistededwards.PointAffine
+	for i := 0; i < 3; i++ {
+		sk, _ := RandSecretJubjub()
+		key := &Key{sk, jubjubMul(pkeCrs.gj, sk.element())}
+		keys = append(keys, key)
+		pks = append(pks, key.pk)
+	}
+	set, err := NewSupervisorSet(pks, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2. user
+	x, _ := RandSecretJubjub()
+	k, _ := RandSecretFr()
+	C := new(bls12381.G1Affine).Add(g1Mul(pokCrs.g, x.element()), g1Mul(pokCrs.h, k.element()))
+	user := &PKEETVPG{x, k, C}
+
+	// 3. prove to supervisor 1, verify with the root alone
+	pvp, err := user.ProofSet(crs, set, 1, 3, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := set.Root()
+	assert.Nil(t, VerifySet(crs, ctxH, &root, pvp))
+
+	var wrong fr.Element
+	wrong.SetRandom()
+	assert.NotNil(t, VerifySet(crs, ctxH, &wrong, pvp))
+	pvp.Root = wrong
+	assert.NotNil(t, VerifySet(crs, ctxH, &root, pvp))
+	pvp.Root = root
+
+	// a proof made with a Pedersen base of the prover's choice is rejected
+	rogue := &CRS{ccs, spk, svk, &PKECRS{pkeCrs.gj, getRandomG()}, pokCrs}
+	forged, err := user.ProofSet(rogue, set, 1, 3, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorContains(t, VerifySet(crs, ctxH, &root, forged), "hj")
+
+	// a malformed proof is an error, not a panic
+	assert.NotNil(t, VerifySet(crs, ctxH, &root, &PKEETVPGSetProof{Root: root}))
+	assert.NotNil(t, VerifySet(crs, ctxH, nil, pvp))
+	forged.ct = nil
+	assert.NotNil(t, VerifySet(crs, ctxH, &root, forged))
+
+	// 4. only the chosen supervisor opens the ciphertext
+	m := jubjubMul(pkeCrs.gj, x.element())
+	for i, key := range keys {
+		m_, err := Dec(pkeCrs, pvp.Ciphertext(), key)
+		if i == 1 {
+			assert.Nil(t, err)
+			assert.True(t, m.Equal(m_))
+		} else {
+			assert.NotNil(t, err)
+		}
+	}
+
+	// a key outside the set cannot be proven
+	sk, _ := RandSecretJubjub()
+	outsider, _ := NewSupervisorSet([]*twistededwards.PointAffine{jubjubMul(pkeCrs.gj, sk.element())}, 2)
+	pvp, err = user.ProofSet(crs, outsider, 0, 3, H)
+	if err == nil {
+		assert.NotNil(t, VerifySet(crs, ctxH, &root, pvp))
+	}
+}
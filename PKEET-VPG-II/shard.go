@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// traceChunk is the most records a worker of traceSPPool takes at once
+const traceChunk = 64
+
+// traceSPPool is traceSP with the batches split into chunks that a pool of
+// workers matches concurrently. The result is the same as traceSP's.
+func traceSPPool(group map[int]*RBatch, bd map[int]*RBD, workers int) ([]int, error) {
+	if len(group) != len(bd) {
+		return nil, errors.New("length mismatch")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	type job struct {
+		i, lo, hi, off int
+	}
+	var jobs []job
+	off := 0
+	for i := 0; i < len(group); i++ {
+		if !group[i].h.Equal(bd[i].h) {
+			return nil, errors.New("h mismatch")
+		}
+		n := len(group[i].rec)
+		for lo := 0; lo < n; lo += traceChunk {
+			jobs = append(jobs, job{i, lo, min(lo+traceChunk, n), off + lo})
+		}
+		off += n
+	}
+
+	// the lines of a token are computed by the first worker that needs them
+	keys := make([]*traceKey, len(bd))
+	once := make([]sync.Once, len(bd))
+	hit := make([]bool, off)
+	jc := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jc {
+				once[j.i].Do(func() { keys[j.i] = newTraceKey(bd[j.i].RLight) })
+				for k, rl := range group[j.i].rec[j.lo:j.hi] {
+					hit[j.off+k] = keys[j.i].match(rl)
+				}
+			}
+		}()
+	}
+	for _, j := range jobs {
+		jc <- j
+	}
+	close(jc)
+	wg.Wait()
+
+	var match []int
+	for k, ok := range hit {
+		if ok {
+			match = append(match, k)
+		}
+	}
+	return match, nil
+}
+
+// Sharded trace. Each SP process holds its own RecordStore, and the stores
+// taken in order make up the global record sequence. The coordinator sends
+// every process only the tokens, as a 4-byte count followed by one store entry
+// per token. The process traces its store and answers with its 8-byte record
+// count, an 8-byte match count and the 8-byte entry numbers of the matches,
+// which the coordinator shifts by the records of the stores before it to get
+// global indices.
+
+func writeTokens(w io.Writer, bds []*RBD) error {
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.BigEndian, uint32(len(bds))); err != nil {
+		return err
+	}
+	epoch := time.Unix(0, 0)
+	for _, bd := range bds {
+		if _, err := bw.Write(encodeEntry(bd.h, epoch, bd.RLight)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func readTokens(r io.Reader) ([]*RBD, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, errors.New("shard: truncated tokens")
+	}
+	// the count is not trusted for the allocation
+	bds := make([]*RBD, 0, min(n, traceChunk))
+	buf := make([]byte, storeEntryLen)
+	for i := uint32(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, errors.New("shard: truncated tokens")
+		}
+		tk, err := decodeEntry(buf, uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		bds = append(bds, &RBD{tk.H, tk.RLight})
+	}
+	return bds, nil
+}
+
+// traceIterPool matches the records of it against the token with the same h,
+// in chunks that a pool of workers takes concurrently, and returns the Seq of
+// the matches in order and the number of records walked. Records under a
+// generator without a token are skipped, as TraceStream skips them.
+func traceIterPool(it *RecordIter, bds []*RBD, workers int) ([]uint64, uint64, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	tokens := traceTokens(bds)
+
+	var mu sync.Mutex
+	var match []uint64
+	jc := make(chan []*StoredRecord, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jc {
+				for _, rec := range chunk {
+					if matchAny(tokens[rec.H.Bytes()], rec.RLight) {
+						mu.Lock()
+						match = append(match, rec.Seq)
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	var n uint64
+	chunk := make([]*StoredRecord, 0, traceChunk)
+	for it.Next() {
+		n++
+		if chunk = append(chunk, it.Record()); len(chunk) == traceChunk {
+			jc <- chunk
+			chunk = make([]*StoredRecord, 0, traceChunk)
+		}
+	}
+	jc <- chunk
+	close(jc)
+	wg.Wait()
+	if err := it.Err(); err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(match, func(a, b int) bool { return match[a] < match[b] })
+	return match, n, nil
+}
+
+// ServeTraceShard is the SP side of the sharded trace: it reads the tokens
+// from r, traces st with a pool of workers and writes the matches to w
+func ServeTraceShard(st *RecordStore, r io.Reader, w io.Writer, workers int) error {
+	bds, err := readTokens(r)
+	if err != nil {
+		return err
+	}
+	match, n, err := traceIterPool(st.Iter(nil, time.Time{}, time.Time{}), bds, workers)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, v := range []uint64{n, uint64(len(match))} {
+		if err = binary.Write(bw, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	for _, k := range match {
+		if err = binary.Write(bw, binary.BigEndian, k); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readMatches reads the answer of an SP process: its record count and the
+// entry numbers of its matches
+func readMatches(r io.Reader) ([]uint64, uint64, error) {
+	var size, n uint64
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, 0, errors.New("shard: truncated matches")
+	}
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, 0, errors.New("shard: truncated matches")
+	}
+	if n > size {
+		return nil, 0, errors.New("shard: more matches than records")
+	}
+	// the count is not trusted for the allocation
+	match := make([]uint64, 0, min(n, traceChunk))
+	for i := uint64(0); i < n; i++ {
+		var k uint64
+		if err := binary.Read(r, binary.BigEndian, &k); err != nil {
+			return nil, 0, errors.New("shard: truncated matches")
+		}
+		if k >= size || (i > 0 && k <= match[i-1]) {
+			return nil, 0, errors.New("shard: bad match index")
+		}
+		match = append(match, k)
+	}
+	return match, size, nil
+}
+
+// TraceSharded traces the records held by SP processes, one per command, with
+// the tokens bds. Each command must run ServeTraceShard over its store on its
+// standard input and output. The matches are merged into global indices over
+// the stores taken in the order of cmds.
+func TraceSharded(bds []*RBD, cmds []*exec.Cmd) ([]int, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("no shards")
+	}
+	var tokens bytes.Buffer
+	if err := writeTokens(&tokens, bds); err != nil {
+		return nil, err
+	}
+	matches := make([][]uint64, len(cmds))
+	sizes := make([]uint64, len(cmds))
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for s, cmd := range cmds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out, stderr bytes.Buffer
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(tokens.Bytes()), &out, &stderr
+			if err := cmd.Run(); err != nil {
+				errs[s] = fmt.Errorf("shard %d: %w: %s", s, err, bytes.TrimSpace(stderr.Bytes()))
+				return
+			}
+			matches[s], sizes[s], errs[s] = readMatches(&out)
+		}()
+	}
+	wg.Wait()
+
+	var match []int
+	off := 0
+	for s := range cmds {
+		if errs[s] != nil {
+			return nil, errs[s]
+		}
+		for _, k := range matches[s] {
+			match = append(match, off+int(k))
+		}
+		off += int(sizes[s])
+	}
+	return match, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTraceShardProcess is the SP process of the sharded trace tests: run by
+// shardCmd, it serves the store at PKEET_TRACE_STORE on its standard input and
+// output
+func TestTraceShardProcess(t *testing.T) {
+	mode := os.Getenv("PKEET_TRACE_SHARD")
+	if mode == "" {
+		t.Skip("run as an SP process only")
+	}
+	if mode == "fail" {
+		fmt.Fprintln(os.Stderr, "shard unavailable")
+		os.Exit(2)
+	}
+	st, err := OpenRecordStore(os.Getenv("PKEET_TRACE_STORE"))
+	if err == nil {
+		err = ServeTraceShard(st, os.Stdin, os.Stdout, 2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func shardCmd(mode, path string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestTraceShardProcess$")
+	cmd.Env = append(os.Environ(), "PKEET_TRACE_SHARD="+mode, "PKEET_TRACE_STORE="+path)
+	return cmd
+}
+
+// shardStores writes the batches of group, in order, to n stores of about as
+// many batches each, and returns their paths
+func shardStores(t *testing.T, group map[int]*RBatch, n int) []string {
+	dir := t.TempDir()
+	paths := make([]string, n)
+	for s := range paths {
+		paths[s] = filepath.Join(dir, fmt.Sprintf("shard%d", s))
+		st, err := OpenRecordStore(paths[s])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := s * len(group) / n; i < (s+1)*len(group)/n; i++ {
+			for _, rl := range group[i].rec {
+				if err = st.Append(group[i].h, time.Unix(0, 0), rl); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		st.Close()
+	}
+	return paths
+}
+
+func tokenList(bd map[int]*RBD) []*RBD {
+	bds := make([]*RBD, len(bd))
+	for i := range bds {
+		bds[i] = bd[i]
+	}
+	return bds
+}
+
+func TestTraceSPPool(t *testing.T) {
+	m := getRandomG2()
+	groups, err := GenerateRecordsLight(m, 200, 2, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := traceR1(groups, m)
+	want, err := traceSP(groups, td)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, want)
+	for _, workers := range []int{0, 1, 3, 8} {
+		match, err := traceSPPool(groups, td, workers)
+		assert.Nil(t, err)
+		assert.Equal(t, want, match)
+	}
+
+	td[1] = td[0]
+	_, err = traceSPPool(groups, td, 4)
+	assert.NotNil(t, err)
+	delete(td, 1)
+	_, err = traceSPPool(groups, td, 4)
+	assert.NotNil(t, err)
+}
+
+func TestTraceSharded(t *testing.T) {
+	m := getRandomG2()
+	groups, err := GenerateRecordsLight(m, 48, 2, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := traceR1(groups, m)
+	want, err := traceSP(groups, td)
+	assert.Nil(t, err)
+
+	// more shards than batches leaves some stores empty
+	for _, n := range []int{1, 3, 10} {
+		paths := shardStores(t, groups, n)
+		cmds := make([]*exec.Cmd, n)
+		for i := range cmds {
+			cmds[i] = shardCmd("serve", paths[i])
+		}
+		match, err := TraceSharded(tokenList(td), cmds)
+		assert.Nil(t, err)
+		assert.Equal(t, want, match)
+	}
+
+	// a failing SP fails the trace
+	paths := shardStores(t, groups, 1)
+	_, err = TraceSharded(tokenList(td), []*exec.Cmd{shardCmd("serve", paths[0]), shardCmd("fail", "")})
+	assert.ErrorContains(t, err, "shard unavailable")
+	_, err = TraceSharded(tokenList(td), []*exec.Cmd{shardCmd("serve", filepath.Join(t.TempDir(), "missing", "store"))})
+	assert.NotNil(t, err)
+	_, err = TraceSharded(tokenList(td), nil)
+	assert.NotNil(t, err)
+}
+
+func TestServeTraceShard(t *testing.T) {
+	m := getRandomG2()
+	groups, _ := GenerateRecordsLight(m, 8, 2, 4)
+	td := traceR1(groups, m)
+	want, _ := traceSP(groups, td)
+	st, err := OpenRecordStore(shardStores(t, groups, 1)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	// only the tokens travel to the SP; a token without records matches nothing
+	var in, out bytes.Buffer
+	h9, _ := benchSchedule.H(9)
+	assert.Nil(t, writeTokens(&in, append(tokenList(td), &RBD{h9, getRLight(m, h9)})))
+	assert.Equal(t, 4+3*storeEntryLen, in.Len())
+	assert.Nil(t, ServeTraceShard(st, bytes.NewReader(in.Bytes()), &out, 2))
+	match, size, err := readMatches(&out)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), size)
+	assert.Equal(t, len(want), len(match))
+	for i := range want {
+		assert.Equal(t, uint64(want[i]), match[i])
+	}
+
+	assert.NotNil(t, ServeTraceShard(st, bytes.NewReader(in.Bytes()[:in.Len()-1]), &out, 2))
+	_, _, err = readMatches(bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 9}))
+	assert.NotNil(t, err)
+	_, _, err = readMatches(bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 9}))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"sort"
+)
+
+// Every service provider has its own H domain: H_e of SP id is the hash of
+// id || e under its HSchedule, so records at two SPs use unrelated generators
+// and cannot be linked without a token. The regulator keeps the registry of
+// SPs and issues, for one target, trace tokens bound to a single SP and epoch.
+// A token for another SP carries another h, and traceSP rejects it.
+
+// SPRegistry maps SP identifiers to their schedules
+type SPRegistry struct {
+	sps map[string]*HSchedule
+}
+
+func NewSPRegistry() *SPRegistry {
+	return &SPRegistry{make(map[string]*HSchedule)}
+}
+
+// Register adds the SP of sched. Identifiers are unique.
+func (reg *SPRegistry) Register(sched *HSchedule) error {
+	if sched.SPID == "" {
+		return errors.New("registry: empty SP identifier")
+	}
+	if sched.Period <= 0 {
+		return errors.New("registry: schedule period must be positive")
+	}
+	if _, ok := reg.sps[sched.SPID]; ok {
+		return fmt.Errorf("registry: SP %q is already registered", sched.SPID)
+	}
+	reg.sps[sched.SPID] = sched
+	return nil
+}
+
+func (reg *SPRegistry) Schedule(id string) (*HSchedule, error) {
+	sched, ok := reg.sps[id]
+	if !ok {
+		return nil, fmt.Errorf("registry: unknown SP %q", id)
+	}
+	return sched, nil
+}
+
+// IDs returns the registered SPs in order
+func (reg *SPRegistry) IDs() []string {
+	ids := make([]string, 0, len(reg.sps))
+	for id := range reg.sps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SPTraceToken is the traceR1 token of one target for one epoch of one SP
+type SPTraceToken struct {
+	SPID  string
+	Epoch uint64
+	*RBD
+}
+
+// Regulator issues trace tokens for the SPs of its registry
+type Regulator struct {
+	reg *SPRegistry
+}
+
+func NewRegulator(reg *SPRegistry) *Regulator {
+	return &Regulator{reg}
+}
+
+// TraceTokens returns the tokens of target m_ for the given epochs of SP id
+func (r *Regulator) TraceTokens(id string, m_ *bls12381.G2Affine, epochs []uint64) ([]*SPTraceToken, error) {
+	sched, err := r.reg.Schedule(id)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*SPTraceToken, len(epochs))
+	for i, e := range epochs {
+		h, err := sched.H(e)
+		if err != nil {
+			return nil, err
+		}
+		tokens[i] = &SPTraceToken{id, e, &RBD{h, getRLight(m_, h)}}
+	}
+	return tokens, nil
+}
+
+// TraceTokensAll returns the tokens of target m_ for the given epochs of every
+// registered SP. Each SP gets its own, so none of them can use another's.
+func (r *Regulator) TraceTokensAll(m_ *bls12381.G2Affine, epochs []uint64) (map[string][]*SPTraceToken, error) {
+	all := make(map[string][]*SPTraceToken, len(r.reg.sps))
+	for _, id := range r.reg.IDs() {
+		tokens, err := r.TraceTokens(id, m_, epochs)
+		if err != nil {
+			return nil, err
+		}
+		all[id] = tokens
+	}
+	return all, nil
+}
+
+// RecordRef locates a record of an SP by epoch and position in its batch
+type RecordRef struct {
+	Epoch uint64
+	Index int
+}
+
+// Trace runs traceSP on the batch of each token. Tokens issued for another SP
+// are rejected, and epochs without records are skipped.
+func (er *EpochRecords) Trace(tokens []*SPTraceToken) ([]RecordRef, error) {
+	var refs []RecordRef
+	for _, tk := range tokens {
+		if tk.SPID != er.sched.SPID {
+			return nil, fmt.Errorf("token was issued for SP %q", tk.SPID)
+		}
+		b, ok := er.batches[tk.Epoch]
+		if !ok {
+			continue
+		}
+		match, err := traceSP(map[int]*RBatch{0: b}, map[int]*RBD{0: tk.RBD})
+		if err != nil {
+			return nil, fmt.Errorf("epoch %d: %w", tk.Epoch, err)
+		}
+		for _, j := range match {
+			refs = append(refs, RecordRef{tk.Epoch, j})
+		}
+	}
+	return refs, nil
+}
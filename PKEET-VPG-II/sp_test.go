@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSPRegistry(t *testing.T) {
+	reg := NewSPRegistry()
+	a := &HSchedule{SPID: "sp-a", Period: time.Hour}
+	b := &HSchedule{SPID: "sp-b", Period: time.Hour}
+	assert.Nil(t, reg.Register(b))
+	assert.Nil(t, reg.Register(a))
+	assert.NotNil(t, reg.Register(&HSchedule{SPID: "sp-a", Period: time.Minute}))
+	assert.NotNil(t, reg.Register(&HSchedule{Period: time.Hour}))
+	assert.NotNil(t, reg.Register(&HSchedule{SPID: "sp-c"}))
+	assert.Equal(t, []string{"sp-a", "sp-b"}, reg.IDs())
+	_, err := reg.Schedule("sp-c")
+	assert.NotNil(t, err)
+
+	// the same epoch has unrelated generators at two SPs
+	ha, _ := a.H(1)
+	hb, _ := b.H(1)
+	assert.False(t, ha.Equal(hb))
+}
+
+func TestPerSPTrace(t *testing.T) {
+	reg := NewSPRegistry()
+	a := &HSchedule{SPID: "sp-a", Period: time.Hour}
+	b := &HSchedule{SPID: "sp-b", Period: time.Hour}
+	assert.Nil(t, reg.Register(a))
+	assert.Nil(t, reg.Register(b))
+
+	// both SPs hold records of the target in epochs 1 and 2
+	m := getRandomG2()
+	records := map[string]*EpochRecords{"sp-a": NewEpochRecords(a), "sp-b": NewEpochRecords(b)}
+	for _, sched := range []*HSchedule{a, b} {
+		for e := uint64(1); e <= 2; e++ {
+			h, _ := sched.H(e)
+			assert.Nil(t, records[sched.SPID].Add(e, getRLight(getRandomG2(), h)))
+			assert.Nil(t, records[sched.SPID].Add(e, getRLight(m, h)))
+		}
+	}
+
+	regulator := NewRegulator(reg)
+	all, err := regulator.TraceTokensAll(m, []uint64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, er := range records {
+		refs, err := er.Trace(all[id])
+		assert.Nil(t, err)
+		assert.Equal(t, []RecordRef{{1, 1}, {2, 1}}, refs)
+	}
+
+	// tokens only work at the SP they were issued for
+	_, err = records["sp-b"].Trace(all["sp-a"])
+	assert.NotNil(t, err)
+	forged := &SPTraceToken{"sp-b", 1, all["sp-a"][0].RBD}
+	_, err = records["sp-b"].Trace([]*SPTraceToken{forged})
+	assert.NotNil(t, err)
+
+	_, err = regulator.TraceTokens("sp-c", m, []uint64{1})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordStore is the append-only file of the tags an SP has collected. After an
+// 8-byte header, the file is a sequence of fixed-size entries
+//
+//	h (G1, 48) | time (unix ns, 8) | ht (G1, 48) | mt (G2, 96) | crc32c (4)
+//
+// with the points compressed and the checksum over the rest of the entry. An
+// append is one write followed by fsync, so a crash leaves at most one partial
+// entry at the tail, which OpenRecordStore drops, and a crash while creating
+// the store leaves a partial header, which it rewrites. A complete entry that
+// fails its checksum was acknowledged, so it is an error wherever it is. Only
+// the entry count is kept in memory; iterators walk the file.
+type RecordStore struct {
+	mu sync.RWMutex
+	f  *os.File
+	n  uint64
+}
+
+const (
+	storeMagic     = "PKEETRS1"
+	storeHeaderLen = len(storeMagic)
+	storeEntryLen  = 2*bls12381.SizeOfG1AffineCompressed + 8 + bls12381.SizeOfG2AffineCompressed + 4
+)
+
+var storeCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// StoredRecord is a tag read back from a RecordStore. Seq is its entry number.
+type StoredRecord struct {
+	Seq uint64
+	H   *bls12381.G1Affine
+	At  time.Time
+	*RLight
+}
+
+// OpenRecordStore opens the store at path, creating it if needed
+func OpenRecordStore(path string) (*RecordStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	st := &RecordStore{f: f}
+	if err = st.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// load checks the header and the entries and drops a partial tail
+func (st *RecordStore) load() error {
+	fi, err := st.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < int64(storeHeaderLen) {
+		// an empty store, possibly with a header torn by a crash
+		header := make([]byte, fi.Size())
+		if _, err = st.f.ReadAt(header, 0); err != nil || string(header) != storeMagic[:len(header)] {
+			return errors.New("record store: bad header")
+		}
+		if _, err = st.f.WriteAt([]byte(storeMagic), 0); err != nil {
+			return err
+		}
+		return st.f.Sync()
+	}
+	header := make([]byte, storeHeaderLen)
+	if _, err = st.f.ReadAt(header, 0); err != nil || string(header) != storeMagic {
+		return errors.New("record store: bad header")
+	}
+
+	size := fi.Size() - int64(storeHeaderLen)
+	entries := uint64(size / int64(storeEntryLen))
+	r := bufio.NewReader(io.NewSectionReader(st.f, entryOffset(0), int64(entries)*int64(storeEntryLen)))
+	buf := make([]byte, storeEntryLen)
+	for i := uint64(0); i < entries; i++ {
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if !checkEntry(buf) {
+			return fmt.Errorf("record store: entry %d is corrupt", i)
+		}
+	}
+	st.n = entries
+	if end := entryOffset(entries); end != fi.Size() {
+		if err = st.f.Truncate(end); err != nil {
+			return err
+		}
+		return st.f.Sync()
+	}
+	return nil
+}
+
+func entryOffset(i uint64) int64 {
+	return int64(storeHeaderLen) + int64(i)*int64(storeEntryLen)
+}
+
+func checkEntry(buf []byte) bool {
+	body := buf[:storeEntryLen-4]
+	return crc32.Checksum(body, storeCRC) == binary.BigEndian.Uint32(buf[storeEntryLen-4:])
+}
+
+// Append stores rl, collected under h at time at, durably
+func (st *RecordStore) Append(h *bls12381.G1Affine, at time.Time, rl *RLight) error {
+	buf := encodeEntry(h, at, rl)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.f == nil {
+		return errors.New("record store is closed")
+	}
+	if _, err := st.f.WriteAt(buf, entryOffset(st.n)); err != nil {
+		return err
+	}
+	if err := st.f.Sync(); err != nil {
+		return err
+	}
+	st.n++
+	return nil
+}
+
+func encodeEntry(h *bls12381.G1Affine, at time.Time, rl *RLight) []byte {
+	buf := make([]byte, 0, storeEntryLen)
+	hb := h.Bytes()
+	buf = append(buf, hb[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(at.UnixNano()))
+	htb := rl.ht.Bytes()
+	buf = append(buf, htb[:]...)
+	mtb := rl.mt.Bytes()
+	buf = append(buf, mtb[:]...)
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, storeCRC))
+}
+
+// decodeEntry checks and decodes entry seq from buf
+func decodeEntry(buf []byte, seq uint64) (*StoredRecord, error) {
+	if !checkEntry(buf) {
+		return nil, fmt.Errorf("record store: entry %d is corrupt", seq)
+	}
+	rec := &StoredRecord{Seq: seq, H: new(bls12381.G1Affine), RLight: &RLight{new(bls12381.G1Affine), new(bls12381.G2Affine)}}
+	off := 0
+	if _, err := rec.H.SetBytes(buf[off : off+bls12381.SizeOfG1AffineCompressed]); err != nil {
+		return nil, err
+	}
+	off += bls12381.SizeOfG1AffineCompressed
+	rec.At = time.Unix(0, int64(binary.BigEndian.Uint64(buf[off:off+8])))
+	off += 8
+	if _, err := rec.ht.SetBytes(buf[off : off+bls12381.SizeOfG1AffineCompressed]); err != nil {
+		return nil, err
+	}
+	off += bls12381.SizeOfG1AffineCompressed
+	if _, err := rec.mt.SetBytes(buf[off : off+bls12381.SizeOfG2AffineCompressed]); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Len returns the number of entries
+func (st *RecordStore) Len() uint64 {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.n
+}
+
+func (st *RecordStore) Close() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.f == nil {
+		return nil
+	}
+	err := st.f.Close()
+	st.f = nil
+	return err
+}
+
+// RecordIter walks the entries of a store in append order, reading the file
+// sequentially
+type RecordIter struct {
+	r        *bufio.Reader
+	buf      []byte
+	h        []byte // nil selects every generator
+	pos, end uint64
+	from, to time.Time
+	rec      *StoredRecord
+	err      error
+}
+
+// Iter returns the entries under h collected in [from, to). A nil h selects
+// every generator, and a zero from or to leaves that side open. Entries
+// appended after the call are not visited.
+func (st *RecordStore) Iter(h *bls12381.G1Affine, from, to time.Time) *RecordIter {
+	it := &RecordIter{buf: make([]byte, storeEntryLen), from: from, to: to}
+	if h != nil {
+		hb := h.Bytes()
+		it.h = hb[:]
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	if st.f == nil {
+		it.err = errors.New("record store is closed")
+		return it
+	}
+	it.end = st.n
+	it.r = bufio.NewReader(io.NewSectionReader(st.f, entryOffset(0), int64(st.n)*int64(storeEntryLen)))
+	return it
+}
+
+// Next moves to the next entry in range and reports whether there is one
+func (it *RecordIter) Next() bool {
+	for it.err == nil && it.pos < it.end {
+		seq := it.pos
+		it.pos++
+		if _, err := io.ReadFull(it.r, it.buf); err != nil {
+			it.err = err
+			return false
+		}
+		// entries under other generators are skipped before decoding
+		if it.h != nil && !bytes.Equal(it.buf[:bls12381.SizeOfG1AffineCompressed], it.h) {
+			continue
+		}
+		rec, err := decodeEntry(it.buf, seq)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if (!it.from.IsZero() && rec.At.Before(it.from)) || (!it.to.IsZero() && !rec.At.Before(it.to)) {
+			continue
+		}
+		it.rec = rec
+		return true
+	}
+	return false
+}
+
+func (it *RecordIter) Record() *StoredRecord {
+	return it.rec
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *RecordIter) Err() error {
+	return it.err
+}
+
+// traceIter is traceSP over an iterator: it returns the entry numbers of the
+// records that match the token bd
+func traceIter(it *RecordIter, bd *RBD) ([]uint64, error) {
+	var match []uint64
+	tk := newTraceKey(bd.RLight)
+	for it.Next() {
+		rec := it.Record()
+		if !rec.H.Equal(bd.h) {
+			return nil, errors.New("h mismatch")
+		}
+		if tk.match(rec.RLight) {
+			match = append(match, rec.Seq)
+		}
+	}
+	return match, it.Err()
+}
+
+// Trace runs traceIter over the entries under the generator of bd collected in
+// [from, to)
+func (st *RecordStore) Trace(bd *RBD, from, to time.Time) ([]uint64, error) {
+	return traceIter(st.Iter(bd.h, from, to), bd)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	st, err := OpenRecordStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched := &HSchedule{SPID: "sp-a", Period: time.Hour}
+	h0, _ := sched.H(0)
+	h1, _ := sched.H(1)
+	m := getRandomG2()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// entries 1, 4 and 5 are the target, 0-2 under h0 and 3-5 under h1
+	for i := 0; i < 6; i++ {
+		h := h0
+		if i >= 3 {
+			h = h1
+		}
+		target := getRandomG2()
+		if i == 1 || i == 4 || i == 5 {
+			target = m
+		}
+		assert.Nil(t, st.Append(h, start.Add(time.Duration(i)*time.Minute), getRLight(target, h)))
+	}
+	assert.Nil(t, st.Close())
+
+	st, err = OpenRecordStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(6), st.Len())
+	it := st.Iter(nil, time.Time{}, time.Time{})
+	n := 0
+	for it.Next() {
+		assert.Equal(t, uint64(n), it.Record().Seq)
+		assert.True(t, it.Record().At.Equal(start.Add(time.Duration(n)*time.Minute)))
+		n++
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 6, n)
+
+	bd1 := &RBD{h1, getRLight(m, h1)}
+	match, err := st.Trace(bd1, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{4, 5}, match)
+	match, err = st.Trace(bd1, start.Add(5*time.Minute), time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5}, match)
+	match, err = st.Trace(&RBD{h0, getRLight(m, h0)}, time.Time{}, start.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Empty(t, match)
+	_, err = traceIter(st.Iter(nil, time.Time{}, time.Time{}), bd1)
+	assert.NotNil(t, err)
+	assert.Nil(t, st.Close())
+
+	// a torn append is dropped on open, and the store keeps working
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(make([]byte, storeEntryLen/2))
+	f.Close()
+	st, err = OpenRecordStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(6), st.Len())
+	assert.Nil(t, st.Append(h1, start.Add(time.Hour), getRLight(m, h1)))
+	match, _ = st.Trace(bd1, time.Time{}, time.Time{})
+	assert.Equal(t, []uint64{4, 5, 6}, match)
+	assert.Nil(t, st.Close())
+	fi, _ := os.Stat(path)
+	assert.Equal(t, entryOffset(7), fi.Size())
+
+	// a corrupt complete entry is an error, even the last one, and the file
+	// is left as it is
+	f, _ = os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte{0xff}, entryOffset(6)+100)
+	f.Close()
+	_, err = OpenRecordStore(path)
+	assert.NotNil(t, err)
+	fi, _ = os.Stat(path)
+	assert.Equal(t, entryOffset(7), fi.Size())
+	f, _ = os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte{0xff}, entryOffset(2)+100)
+	f.Close()
+	_, err = OpenRecordStore(path)
+	assert.NotNil(t, err)
+
+	bad := filepath.Join(t.TempDir(), "bad")
+	os.WriteFile(bad, []byte("not a record store"), 0o600)
+	_, err = OpenRecordStore(bad)
+	assert.NotNil(t, err)
+	os.WriteFile(bad, []byte("PKX"), 0o600)
+	_, err = OpenRecordStore(bad)
+	assert.NotNil(t, err)
+
+	// a header torn while creating the store leaves an empty store
+	torn := filepath.Join(t.TempDir(), "torn")
+	os.WriteFile(torn, []byte(storeMagic[:5]), 0o600)
+	st, err = OpenRecordStore(torn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(0), st.Len())
+	assert.Nil(t, st.Append(h0, start, getRLight(m, h0)))
+	assert.Nil(t, st.Close())
+	st, err = OpenRecordStore(torn)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), st.Len())
+	st.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"io"
+	"time"
+)
+
+// Streaming trace. Records come one at a time from a RecordSource, either a
+// RecordIter over a store or a RecordReader over a stream of store entries,
+// and only one record and the tokens are held at any time.
+
+// RecordSource yields records in order, like RecordIter
+type RecordSource interface {
+	Next() bool
+	Record() *StoredRecord
+	Err() error
+}
+
+// RecordReader reads store entries from r. The stream is the content of a
+// record store, with or without its header.
+type RecordReader struct {
+	r      io.Reader
+	buf    []byte
+	seq    uint64
+	header bool
+	rec    *StoredRecord
+	err    error
+}
+
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: r, buf: make([]byte, storeEntryLen)}
+}
+
+func (rr *RecordReader) Next() bool {
+	if rr.err != nil {
+		return false
+	}
+	if !rr.header {
+		// the header is shorter than an entry, so peek at it first
+		rr.header = true
+		if _, err := io.ReadFull(rr.r, rr.buf[:storeHeaderLen]); err != nil {
+			if err != io.EOF {
+				rr.err = err
+			}
+			return false
+		}
+		if string(rr.buf[:storeHeaderLen]) == storeMagic {
+			return rr.Next()
+		}
+		if _, err := io.ReadFull(rr.r, rr.buf[storeHeaderLen:]); err != nil {
+			rr.err = errors.New("record stream: truncated entry")
+			return false
+		}
+		return rr.decode()
+	}
+	if _, err := io.ReadFull(rr.r, rr.buf); err != nil {
+		if err != io.EOF {
+			rr.err = errors.New("record stream: truncated entry")
+		}
+		return false
+	}
+	return rr.decode()
+}
+
+func (rr *RecordReader) decode() bool {
+	rec, err := decodeEntry(rr.buf, rr.seq)
+	if err != nil {
+		rr.err = err
+		return false
+	}
+	rr.seq++
+	rr.rec = rec
+	return true
+}
+
+func (rr *RecordReader) Record() *StoredRecord {
+	return rr.rec
+}
+
+func (rr *RecordReader) Err() error {
+	return rr.err
+}
+
+// traceTokens groups the tokens by generator, since several targets may share
+// one
+func traceTokens(bds []*RBD) map[[bls12381.SizeOfG1AffineCompressed]byte][]*traceKey {
+	tokens := make(map[[bls12381.SizeOfG1AffineCompressed]byte][]*traceKey, len(bds))
+	for _, bd := range bds {
+		key := bd.h.Bytes()
+		tokens[key] = append(tokens[key], newTraceKey(bd.RLight))
+	}
+	return tokens
+}
+
+// matchAny reports whether rl matches any of the tokens
+func matchAny(tks []*traceKey, rl *RLight) bool {
+	for _, tk := range tks {
+		if tk.match(rl) {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceStream matches every record of src against the tokens with the same h
+// and sends the Seq of each record that matches one of them. Records under a
+// generator without a token are skipped. The match channel is closed when src
+// is exhausted, ctx is done or an error occurs, and the error channel then
+// yields the outcome. The caller must drain the match channel or cancel ctx,
+// or the trace blocks on the next match.
+func TraceStream(ctx context.Context, src RecordSource, bds []*RBD) (<-chan uint64, <-chan error) {
+	match := make(chan uint64)
+	errc := make(chan error, 1)
+	tokens := traceTokens(bds)
+	go func() {
+		defer close(match)
+		for src.Next() {
+			if err := ctx.Err(); err != nil {
+				errc <- err
+				return
+			}
+			rec := src.Record()
+			if !matchAny(tokens[rec.H.Bytes()], rec.RLight) {
+				continue
+			}
+			select {
+			case match <- rec.Seq:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+		errc <- src.Err()
+	}()
+	return match, errc
+}
+
+// WriteRecordsLight is GenerateRecordsLight written to w as a record stream,
+// without holding the records in memory
+func WriteRecordsLight(w io.Writer, m *bls12381.G2Affine, total, rate, batchSize int) error {
+	return generateRecordsLight(m, total, rate, batchSize, func(epoch uint64, h *bls12381.G1Affine, rl *RLight) error {
+		at := benchSchedule.Start.Add(time.Duration(epoch) * benchSchedule.Period)
+		_, err := w.Write(encodeEntry(h, at, rl))
+		return err
+	})
+}
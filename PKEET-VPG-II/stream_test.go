@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func collect(match <-chan uint64, errc <-chan error) ([]uint64, error) {
+	var seqs []uint64
+	for seq := range match {
+		seqs = append(seqs, seq)
+	}
+	return seqs, <-errc
+}
+
+// recordStream writes 4 records per epoch 0-2, the target at odd positions
+func recordStream(m *bls12381.G2Affine) []byte {
+	var buf bytes.Buffer
+	for e := uint64(0); e < 3; e++ {
+		h, _ := benchSchedule.H(e)
+		for j := 0; j < 4; j++ {
+			target := getRandomG2()
+			if j%2 == 1 {
+				target = m
+			}
+			buf.Write(encodeEntry(h, benchSchedule.Start, getRLight(target, h)))
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestTraceStream(t *testing.T) {
+	m := getRandomG2()
+	stream := recordStream(m)
+	h0, _ := benchSchedule.H(0)
+	h2, _ := benchSchedule.H(2)
+	bds := []*RBD{{h0, getRLight(m, h0)}, {h2, getRLight(m, h2)}}
+
+	// records under epoch 1 have no token and are skipped
+	seqs, err := collect(TraceStream(context.Background(), NewRecordReader(bytes.NewReader(stream)), bds))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 3, 9, 11}, seqs)
+
+	seqs, err = collect(TraceStream(context.Background(), NewRecordReader(bytes.NewReader(stream)), []*RBD{{h0, getRLight(getRandomG2(), h0)}}))
+	assert.Nil(t, err)
+	assert.Empty(t, seqs)
+
+	// tokens of several targets may share a generator
+	seqs, err = collect(TraceStream(context.Background(), NewRecordReader(bytes.NewReader(stream)), []*RBD{{h0, getRLight(m, h0)}, {h0, getRLight(getRandomG2(), h0)}}))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 3}, seqs)
+	seqs, err = collect(TraceStream(context.Background(), NewRecordReader(bytes.NewReader(stream)), []*RBD{{h0, getRLight(getRandomG2(), h0)}, {h0, getRLight(m, h0)}}))
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 3}, seqs)
+
+	// a truncated stream is an error
+	_, err = collect(TraceStream(context.Background(), NewRecordReader(bytes.NewReader(stream[:len(stream)-1])), bds))
+	assert.NotNil(t, err)
+
+	// cancelling stops the trace
+	ctx, cancel := context.WithCancel(context.Background())
+	match, errc := TraceStream(ctx, NewRecordReader(bytes.NewReader(stream)), bds)
+	<-match
+	cancel()
+	for range match {
+	}
+	assert.Equal(t, context.Canceled, <-errc)
+}
+
+func TestWriteRecordsLight(t *testing.T) {
+	m := getRandomG2()
+	var buf bytes.Buffer
+	assert.Nil(t, WriteRecordsLight(&buf, m, 12, 2, 4))
+	assert.Equal(t, 12*storeEntryLen, buf.Len())
+
+	// the generator and the trace run concurrently through a pipe
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(WriteRecordsLight(pw, m, 20, 1, 5))
+	}()
+	h0, _ := benchSchedule.H(0)
+	rr := NewRecordReader(pr)
+	seqs, err := collect(TraceStream(context.Background(), rr, []*RBD{{h0, getRLight(m, h0)}}))
+	assert.Nil(t, err)
+	assert.Empty(t, seqs)
+	assert.Equal(t, uint64(20), rr.seq)
+}
+
+func TestTraceStreamStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	st, err := OpenRecordStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	m := getRandomG2()
+	rr := NewRecordReader(bytes.NewReader(recordStream(m)))
+	for rr.Next() {
+		rec := rr.Record()
+		assert.Nil(t, st.Append(rec.H, rec.At, rec.RLight))
+	}
+	assert.Nil(t, rr.Err())
+
+	h1, _ := benchSchedule.H(1)
+	bd := &RBD{h1, getRLight(m, h1)}
+	want, err := st.Trace(bd, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5, 7}, want)
+	seqs, err := collect(TraceStream(context.Background(), st.Iter(nil, time.Time{}, time.Time{}), []*RBD{bd}))
+	assert.Nil(t, err)
+	assert.Equal(t, want, seqs)
+
+	// the store file, header included, reads back as a stream
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seqs, err = collect(TraceStream(context.Background(), NewRecordReader(f), []*RBD{bd}))
+	assert.Nil(t, err)
+	assert.Equal(t, want, seqs)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"math/big"
+)
+
+// The supervisor key can be Shamir-shared t-of-n over the Jubjub scalar field:
+// holder i keeps sk_i = f(i) for a polynomial f of degree t-1 with f(0) = sk,
+// and publishes vk_i = gj^{sk_i}. pk = gj^sk is unchanged, so Enc and PKECricuit
+// do not know about the sharing. Each holder answers a ciphertext with
+// Y_i = U^{sk_i} and a DLEQ proof against vk_i, and any t valid answers give
+// Y = U^sk by Lagrange interpolation in the exponent.
+
+// ThresholdKey is the public side of a shared supervisor key
+type ThresholdKey struct {
+	T, N int
+	pk   *twistededwards.PointAffine
+	vks  []*twistededwards.PointAffine // vks[i-1] = gj^{sk_i}
+}
+
+// KeyShare is the secret share of holder Index, in [1, N]
+type KeyShare struct {
+	Index uint32
+	sk    SecretScalar
+	vk    *twistededwards.PointAffine
+}
+
+// PartialDecryption is the answer of one share holder to U
+type PartialDecryption struct {
+	Index uint32
+	Y     *twistededwards.PointAffine
+	*DLEQProof
+}
+
+func (tk *ThresholdKey) PublicKey() *twistededwards.PointAffine {
+	return tk.pk
+}
+
+// VerificationKey returns vk_i, or nil if i is not a share index
+func (tk *ThresholdKey) VerificationKey(i uint32) *twistededwards.PointAffine {
+	if i == 0 || int(i) > tk.N {
+		return nil
+	}
+	return tk.vks[i-1]
+}
+
+// SplitKey shares key t-of-n with a trusted dealer. The caller should Destroy
+// key once the shares are handed out.
+func SplitKey(key *Key, t, n int) (*ThresholdKey, []*KeyShare, error) {
+	if t < 1 || t > n || n >= 1<<16 {
+		return nil, nil, fmt.Errorf("invalid threshold %d-of-%d", t, n)
+	}
+	coeffs := make([][4]uint64, t)
+	defer func() {
+		for i := range coeffs {
+			wipeLimbs(&coeffs[i])
+		}
+	}()
+	coeffs[0] = key.sk.element().Bits()
+	if ctLess(coeffs[0], jubjubOrder) == 0 {
+		return nil, nil, errors.New("secret is not reduced modulo the Jubjub order")
+	}
+	for i := 1; i < t; i++ {
+		a, err := randJubjubScalar()
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to generate random number: %w", err)
+		}
+		coeffs[i] = a.Bits()
+		wipeElement(a)
+	}
+
+	curve := twistededwards.GetEdwardsCurve()
+	tk := &ThresholdKey{T: t, N: n, pk: key.pk, vks: make([]*twistededwards.PointAffine, n)}
+	shares := make([]*KeyShare, n)
+	for i := 1; i <= n; i++ {
+		si := evalPoly(coeffs, uint64(i))
+		sk := SecretScalar{frFromLimbs(si)}
+		wipeLimbs(&si)
+		vk := jubjubMul(&curve.Base, sk.element())
+		tk.vks[i-1] = vk
+		shares[i-1] = &KeyShare{uint32(i), sk, vk}
+	}
+	return tk, shares, nil
+}
+
+// evalPoly returns f(i) mod p for secret coefficients and a public point i
+func evalPoly(coeffs [][4]uint64, i uint64) [4]uint64 {
+	var acc [4]uint64
+	for j := len(coeffs) - 1; j >= 0; j-- {
+		acc = ctAddMod(ctMulSmallMod(acc, i, jubjubOrder), coeffs[j], jubjubOrder)
+	}
+	return acc
+}
+
+// PartialDecrypt returns U^{sk_i} with a DLEQ proof against vk_i
+func (ks *KeyShare) PartialDecrypt(U *twistededwards.PointAffine) (*PartialDecryption, error) {
+	if err := checkJubjubPoint(U); err != nil {
+		return nil, err
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	Y := jubjubMul(U, ks.sk.element())
+	pf, err := proveDLEQ(nil, &curve.Base, ks.vk, U, Y, ks.sk.element())
+	if err != nil {
+		return nil, err
+	}
+	return &PartialDecryption{ks.Index, Y, pf}, nil
+}
+
+func (ks *KeyShare) Destroy() {
+	ks.sk.Destroy()
+}
+
+// VerifyPartial checks a partial decryption of U against vk_Index
+func (tk *ThresholdKey) VerifyPartial(U *twistededwards.PointAffine, pd *PartialDecryption) error {
+	if pd == nil || pd.DLEQProof == nil {
+		return errors.New("missing partial decryption")
+	}
+	vk := tk.VerificationKey(pd.Index)
+	if vk == nil {
+		return fmt.Errorf("unknown share index %d", pd.Index)
+	}
+	if err := checkJubjubPoint(pd.Y); err != nil {
+		return fmt.Errorf("share %d: %w", pd.Index, err)
+	}
+	curve := twistededwards.GetEdwardsCurve()
+	if err := verifyDLEQ(nil, &curve.Base, vk, U, pd.Y, pd.DLEQProof); err != nil {
+		return fmt.Errorf("share %d: %w", pd.Index, err)
+	}
+	return nil
+}
+
+// Combine checks every partial decryption of ct, interpolates Y from the first
+// T valid ones and finishes Dec. It returns the indices of the invalid partials,
+// also when there are not enough valid ones left to decrypt.
+func Combine(crs *PKECRS, tk *ThresholdKey, ct *Ciphertext, parts []*PartialDecryption) (*twistededwards.PointAffine, []uint32, error) {
+	curve := twistededwards.GetEdwardsCurve()
+	if !crs.gj.Equal(&curve.Base) {
+		return nil, nil, errors.New("threshold decryption assumes gj is the Jubjub base point")
+	}
+	if err := checkJubjubPoint(ct.U); err != nil {
+		return nil, nil, err
+	}
+
+	var invalid []uint32
+	var valid []*PartialDecryption
+	seen := make(map[uint32]bool)
+	for _, pd := range parts {
+		if tk.VerifyPartial(ct.U, pd) != nil {
+			if pd != nil {
+				invalid = append(invalid, pd.Index)
+			}
+			continue
+		}
+		if !seen[pd.Index] {
+			seen[pd.Index] = true
+			valid = append(valid, pd)
+		}
+	}
+	if len(valid) < tk.T {
+		return nil, invalid, fmt.Errorf("need %d valid partial decryptions, got %d", tk.T, len(valid))
+	}
+	valid = valid[:tk.T]
+
+	indices := make([]uint32, len(valid))
+	Ys := make([]*twistededwards.PointAffine, len(valid))
+	for i, pd := range valid {
+		indices[i], Ys[i] = pd.Index, pd.Y
+	}
+	m, err := decWithY(crs, ct, interpolateExp(indices, Ys))
+	if err != nil {
+		return nil, invalid, err
+	}
+	return m, invalid, nil
+}
+
+// lagrangeAtZero returns the Lagrange coefficients at 0 modulo the Jubjub order
+// for distinct nonzero indices
+func lagrangeAtZero(indices []uint32) []*big.Int {
+	curve := twistededwards.GetEdwardsCurve()
+	p := &curve.Order
+	res := make([]*big.Int, len(indices))
+	for i, xi := range indices {
+		num, den := big.NewInt(1), big.NewInt(1)
+		for j, xj := range indices {
+			if i == j {
+				continue
+			}
+			num.Mul(num, big.NewInt(int64(xj)))
+			num.Mod(num, p)
+			den.Mul(den, big.NewInt(int64(xj)-int64(xi)))
+			den.Mod(den, p)
+		}
+		res[i] = num.Mul(num, den.ModInverse(den, p)).Mod(num, p)
+	}
+	return res
+}
+
+// CheckThresholdKey checks that the verification keys lie on a polynomial of
+// degree T-1 through pk, by interpolating pk from every window of T
+// consecutive indices
+func CheckThresholdKey(tk *ThresholdKey) error {
+	if tk.T < 1 || tk.T > tk.N || len(tk.vks) != tk.N {
+		return errors.New("malformed threshold key")
+	}
+	for _, vk := range append([]*twistededwards.PointAffine{tk.pk}, tk.vks...) {
+		if err := checkJubjubPoint(vk); err != nil {
+			return err
+		}
+	}
+	for start := 1; start+tk.T-1 <= tk.N; start++ {
+		indices := make([]uint32, tk.T)
+		for i := range indices {
+			indices[i] = uint32(start + i)
+		}
+		if !interpolateExp(indices, tk.vks[start-1:start-1+tk.T]).Equal(tk.pk) {
+			return fmt.Errorf("verification keys %d..%d do not interpolate to pk", start, start+tk.T-1)
+		}
+	}
+	return nil
+}
+
+// interpolateExp returns P(0) for the points P(indices[i]) = points[i] of a
+// polynomial in the exponent
+func interpolateExp(indices []uint32, points []*twistededwards.PointAffine) *twistededwards.PointAffine {
+	lambda := lagrangeAtZero(indices)
+	res := new(twistededwards.PointAffine)
+	res.X.SetZero()
+	res.Y.SetOne()
+	for i, P := range points {
+		res.Add(res, new(twistededwards.PointAffine).ScalarMultiplication(P, lambda[i]))
+	}
+	return res
+}
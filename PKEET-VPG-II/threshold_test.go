@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestThresholdDecryption(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs := &PKECRS{&curve.Base, getRandomG()}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+
+	tk, shares, err := SplitKey(key, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, CheckThresholdKey(tk))
+	assert.True(t, key.pk.Equal(tk.PublicKey()))
+
+	x, _ := randJubjubScalar()
+	v, _ := randJubjubScalar()
+	m := jubjubMul(crs.gj, x)
+	ct, err := Enc(crs, tk.PublicKey(), 0, m, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make([]*PartialDecryption, len(shares))
+	for i, ks := range shares {
+		parts[i], err = ks.PartialDecrypt(ct.U)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, tk.VerifyPartial(ct.U, parts[i]))
+	}
+
+	// any 3 shares decrypt
+	for _, set := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}} {
+		sub := make([]*PartialDecryption, len(set))
+		for i, j := range set {
+			sub[i] = parts[j]
+		}
+		m_, invalid, err := Combine(crs, tk, ct, sub)
+		assert.Nil(t, err)
+		assert.Empty(t, invalid)
+		assert.Equal(t, m, m_)
+	}
+
+	// a corrupted share is reported and skipped
+	bad := &PartialDecryption{parts[1].Index, new(twistededwards.PointAffine).Add(parts[1].Y, crs.gj), parts[1].DLEQProof}
+	m_, invalid, err := Combine(crs, tk, ct, []*PartialDecryption{parts[0], bad, parts[2], parts[3]})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{2}, invalid)
+	assert.Equal(t, m, m_)
+
+	// a share answering for another index is reported
+	swapped := &PartialDecryption{parts[4].Index, parts[3].Y, parts[3].DLEQProof}
+	_, invalid, err = Combine(crs, tk, ct, []*PartialDecryption{parts[0], swapped, bad})
+	assert.NotNil(t, err)
+	assert.Equal(t, []uint32{5, 2}, invalid)
+
+	// duplicates do not count twice
+	_, _, err = Combine(crs, tk, ct, []*PartialDecryption{parts[0], parts[0], parts[1]})
+	assert.NotNil(t, err)
+}
+
+func TestCheckThresholdKey(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(&curve.Base, sk.element())}
+
+	for _, tn := range [][2]int{{1, 1}, {1, 3}, {2, 3}, {4, 4}} {
+		tk, _, err := SplitKey(key, tn[0], tn[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Nil(t, CheckThresholdKey(tk))
+	}
+
+	tk, _, _ := SplitKey(key, 2, 4)
+	tk.vks[3] = new(twistededwards.PointAffine).Add(tk.vks[3], &curve.Base)
+	assert.NotNil(t, CheckThresholdKey(tk))
+
+	_, _, err := SplitKey(key, 4, 3)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	twistededwards2 "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	twistededwards1 "github.com/consensys/gnark/std/algebra/native/twistededwards"
+)
+
+// Verifiable encryption on its own: the VEPKECricuit SNARK shows that a
+// ciphertext to pk holds the m = gj^x committed in B = m hj^s, without the
+// BLS12-381 commitment C, the PoK or the CGPoK of PKEETVPGProof. Only the
+// Groth16 pairing check remains on the verifier side. VEPKECricuit is
+// PKECricuit without Y among the public inputs, so the proof does not open
+// the ciphertext to the verifier.
+
+// VEPKECricuit proves the relations of PKECricuit with Y = pk^v private
+type VEPKECricuit struct {
+	V  frontend.Variable
+	X  frontend.Variable
+	S  frontend.Variable
+	MX frontend.Variable
+	MY frontend.Variable
+
+	HX frontend.Variable `gnark:",public"`
+	HY frontend.Variable `gnark:",public"`
+
+	PKX frontend.Variable `gnark:",public"`
+	PKY frontend.Variable `gnark:",public"`
+	UX  frontend.Variable `gnark:",public"`
+	UY  frontend.Variable `gnark:",public"`
+	VX  frontend.Variable `gnark:",public"`
+	VY  frontend.Variable `gnark:",public"`
+
+	W  frontend.Variable `gnark:",public"`
+	W1 frontend.Variable `gnark:",public"`
+	W2 frontend.Variable `gnark:",public"`
+
+	BX frontend.Variable `gnark:",public"`
+	BY frontend.Variable `gnark:",public"`
+
+	KID frontend.Variable `gnark:",public"`
+}
+
+// Positions of the public inputs of VEPKECricuit in its public witness: those
+// of PKECricuit without YX, YY. Circuits embedding it add theirs after vpubKID.
+const (
+	vpubHX  = 0
+	vpubPKX = 2
+	vpubUX  = 4
+	vpubW   = 8
+	vpubBX  = 11
+	vpubKID = 13
+)
+
+func (circuit *VEPKECricuit) Define(api frontend.API) error {
+	_, err := circuit.define(api)
+	return err
+}
+
+// define constrains the ciphertext and B and returns Y = PK^V to the circuits
+// that build on VEPKECricuit
+func (circuit *VEPKECricuit) define(api frontend.API) (twistededwards1.Point, error) {
+	curve, err := twistededwards1.NewEdCurve(api, twistededwards2.BLS12_381)
+	if err != nil {
+		panic(err)
+	}
+	base := twistededwards1.Point{
+		X: curve.Params().Base[0],
+		Y: curve.Params().Base[1],
+	}
+	H := twistededwards1.Point{
+		X: circuit.HX,
+		Y: circuit.HY,
+	}
+	PK := twistededwards1.Point{
+		X: circuit.PKX,
+		Y: circuit.PKY,
+	}
+
+	m_ := curve.ScalarMul(base, circuit.X)
+	api.AssertIsEqual(m_.X, circuit.MX)
+	api.AssertIsEqual(m_.Y, circuit.MY)
+
+	_Y, err := defineEnc(api, curve, base, m_, circuit.MX, circuit.MY, PK, &encVars{circuit.V, circuit.UX, circuit.UY, circuit.VX, circuit.VY, circuit.W, circuit.W1, circuit.W2, circuit.KID})
+	if err != nil {
+		return _Y, err
+	}
+
+	ind2 := curve.ScalarMul(H, circuit.S)
+	B_ := curve.Add(m_, ind2)
+	api.AssertIsEqual(B_.X, circuit.BX)
+	api.AssertIsEqual(B_.Y, circuit.BY)
+
+	return _Y, nil
+}
+
+// veAssignment is the assignment of PKECricuit without Y
+func veAssignment(base *PKECricuit) VEPKECricuit {
+	return VEPKECricuit{
+		V:   base.V,
+		X:   base.X,
+		S:   base.S,
+		MX:  base.MX,
+		MY:  base.MY,
+		HX:  base.HX,
+		HY:  base.HY,
+		PKX: base.PKX,
+		PKY: base.PKY,
+		UX:  base.UX,
+		UY:  base.UY,
+		VX:  base.VX,
+		VY:  base.VY,
+		W:   base.W,
+		W1:  base.W1,
+		W2:  base.W2,
+		BX:  base.BX,
+		BY:  base.BY,
+		KID: base.KID,
+	}
+}
+
+func veAssign(base *PKECricuit, _ *Ciphertext, _, _ *twistededwards.PointAffine, _ *fr.Element) frontend.Circuit {
+	assignment := veAssignment(base)
+	return &assignment
+}
+
+// VECRS is the CRS of ProveEncryption and VerifyEncryption
+type VECRS struct {
+	ccs constraint.ConstraintSystem
+	spk groth16.ProvingKey
+	svk groth16.VerifyingKey
+	*PKECRS
+}
+
+// SetupEncryption compiles VEPKECricuit and runs the Groth16 setup for it
+func SetupEncryption(crs *PKECRS) (*VECRS, error) {
+	ccs, err := frontend.Compile(ecc.BLS12_381.ScalarField(), r1cs.NewBuilder, &VEPKECricuit{})
+	if err != nil {
+		return nil, err
+	}
+	spk, svk, err := groth16.Setup(ccs)
+	if err != nil {
+		return nil, err
+	}
+	return &VECRS{ccs, spk, svk, crs}, nil
+}
+
+type EncProof struct {
+	Epoch uint32
+	B     *twistededwards.PointAffine
+	ct    *Ciphertext
+
+	pubWit     witness.Witness
+	snarkProof groth16.Proof
+}
+
+// ProveEncryption encrypts m = gj^x to pk under epoch and proves that the
+// ciphertext holds the m of B = m hj^s. The caller keeps s to open B elsewhere.
+func ProveEncryption(crs *VECRS, pk *twistededwards.PointAffine, epoch uint32, x, s SecretScalar) (*EncProof, error) {
+	if err := checkJubjubPoint(pk); err != nil {
+		return nil, err
+	}
+	ct, B, publicWitness, snarkProof, err := proveEnc(crs.ccs, crs.spk, crs.PKECRS, pk, epoch, x.element(), s.element(), veAssign)
+	if err != nil {
+		return nil, err
+	}
+	return &EncProof{
+		Epoch:      epoch,
+		B:          B,
+		ct:         ct,
+		pubWit:     publicWitness,
+		snarkProof: snarkProof,
+	}, nil
+}
+
+// VerifyEncryption checks that the ciphertext of pvp goes to pk and holds the
+// m committed in pvp.B
+func VerifyEncryption(crs *VECRS, pk *twistededwards.PointAffine, pvp *EncProof) error {
+	if pvp == nil || pvp.B == nil || pvp.pubWit == nil || pvp.snarkProof == nil {
+		return errors.New("malformed proof")
+	}
+	err := groth16.Verify(pvp.snarkProof, crs.svk, pvp.pubWit)
+	if err != nil {
+		return errors.New("snark verification failed: " + err.Error())
+	}
+	pub, ok := pvp.pubWit.Vector().(fr.Vector)
+	if !ok || len(pub) != vpubKID+1 {
+		return errors.New("malformed public witness")
+	}
+	if err = checkKeyInputs(crs.PKECRS, pk, pub, vpubHX, vpubPKX); err != nil {
+		return err
+	}
+	if err = checkCtInputs(pvp.ct, pub, vpubUX, vpubW, vpubKID); err != nil {
+		return err
+	}
+	if err = checkNoTag(pvp.ct); err != nil {
+		return err
+	}
+	if pvp.ct.Epoch != pvp.Epoch {
+		return errors.New("key epoch does not match the snark statement")
+	}
+	if !pvp.B.X.Equal(&pub[vpubBX]) || !pvp.B.Y.Equal(&pub[vpubBX+1]) {
+		return errors.New("B does not match the snark statement")
+	}
+	return nil
+}
+
+// Ciphertext returns the encryption of m proven by pvp
+func (pvp *EncProof) Ciphertext() *Ciphertext {
+	return pvp.ct
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVerifiableEncryption(t *testing.T) {
+	curve := twistededwards.GetEdwardsCurve()
+	crs, err := SetupEncryption(&PKECRS{&curve.Base, getRandomG()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, _ := RandSecretJubjub()
+	key := &Key{sk, jubjubMul(crs.gj, sk.element())}
+
+	x, _ := RandSecretJubjub()
+	s, _ := RandSecretJubjub()
+	pvp, err := ProveEncryption(crs, key.pk, 4, x, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, VerifyEncryption(crs, key.pk, pvp))
+
+	// B opens to m with the caller's s
+	m := jubjubMul(crs.gj, x.element())
+	B := new(twistededwards.PointAffine).Add(m, jubjubMul(crs.hj, s.element()))
+	assert.True(t, B.Equal(pvp.B))
+	m_, err := Dec(crs.PKECRS, pvp.Ciphertext(), key)
+	assert.Nil(t, err)
+	assert.True(t, m.Equal(m_))
+
+	// the public witness does not hold Y, which opens the ciphertext
+	Y := jubjubMul(pvp.ct.U, sk.element())
+	for _, e := range pvp.pubWit.Vector().(fr.Vector) {
+		assert.False(t, e.Equal(&Y.X) || e.Equal(&Y.Y))
+	}
+
+	// wrong key, B, epoch or ciphertext
+	assert.NotNil(t, VerifyEncryption(crs, getRandomG(), pvp))
+	pvp.B = getRandomG()
+	assert.NotNil(t, VerifyEncryption(crs, key.pk, pvp))
+	pvp.B = B
+	pvp.Epoch = 5
+	assert.NotNil(t, VerifyEncryption(crs, key.pk, pvp))
+	pvp.Epoch = 4
+	U := pvp.ct.U
+	pvp.ct.U = getRandomG()
+	assert.NotNil(t, VerifyEncryption(crs, key.pk, pvp))
+	pvp.ct.U = U
+	assert.Nil(t, VerifyEncryption(crs, key.pk, pvp))
+
+	// another hj changes the statement
+	other := &VECRS{crs.ccs, crs.spk, crs.svk, &PKECRS{crs.gj, getRandomG()}}
+	assert.NotNil(t, VerifyEncryption(other, key.pk, pvp))
+	assert.NotNil(t, VerifyEncryption(crs, key.pk, &EncProof{}))
+}
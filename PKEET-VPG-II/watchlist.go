@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"sort"
+)
+
+// Watchlist trace. A regulator watching many targets gives the SP, for each
+// batch, one token per target, and the SP scans its records once for all of
+// them. For a record rl, the test of a token is
+//
+//	e(ht, rl.mt) * e(-rl.ht, mt) == 1
+//
+// and tokens with the same ht share the first Miller loop, so a record costs
+// one Miller loop per distinct ht and, per target, the fixed-Q loop of mt and a
+// final exponentiation. traceR1Watchlist blinds the tokens of a batch with a
+// single t, so they all share it.
+
+// WatchMatch says that the record at index Record, counted as traceSP counts
+// it, belongs to the target at index Target of the watchlist
+type WatchMatch struct {
+	Record int
+	Target int
+}
+
+// traceR1Watchlist returns, for every batch, the tokens of the targets ms in
+// the order of ms
+func traceR1Watchlist(rec map[int]*RBatch, ms []*bls12381.G2Affine) map[int][]*RBD {
+	groups := make(map[int][]*RBD)
+	for k, v := range rec {
+		t, err := rand.Int(rand.Reader, bls12381.ID.ScalarField())
+		if err != nil {
+			panic(err)
+		}
+		ht := new(bls12381.G1Affine).ScalarMultiplication(v.h, t)
+		bds := make([]*RBD, len(ms))
+		for i, m := range ms {
+			bds[i] = &RBD{v.h, &RLight{ht, new(bls12381.G2Affine).ScalarMultiplication(m, t)}}
+		}
+		groups[k] = bds
+	}
+	return groups
+}
+
+// watchGroup is the tokens of a batch that share ht
+type watchGroup struct {
+	ht      bls12381.G1Affine
+	keys    []*traceKey
+	targets []int
+}
+
+// traceWatchlist scans every record once against all the tokens of its batch
+// and returns the matches ordered by record, then target
+func traceWatchlist(group map[int]*RBatch, bd map[int][]*RBD) ([]WatchMatch, error) {
+	if len(group) != len(bd) {
+		return nil, errors.New("length mismatch")
+	}
+	var match []WatchMatch
+	off := 0
+	for i := 0; i < len(group); i++ {
+		var groups []*watchGroup
+		byHT := make(map[[bls12381.SizeOfG1AffineCompressed]byte]*watchGroup)
+		for k, tk := range bd[i] {
+			if !group[i].h.Equal(tk.h) {
+				return nil, errors.New("h mismatch")
+			}
+			key := tk.ht.Bytes()
+			g, ok := byHT[key]
+			if !ok {
+				g = &watchGroup{ht: *tk.ht}
+				byHT[key] = g
+				groups = append(groups, g)
+			}
+			g.keys = append(g.keys, newTraceKey(tk.RLight))
+			g.targets = append(g.targets, k)
+		}
+
+		for j, rl := range group[i].rec {
+			var nht bls12381.G1Affine
+			nht.Neg(rl.ht)
+			for _, g := range groups {
+				f, err := bls12381.MillerLoop([]bls12381.G1Affine{g.ht}, []bls12381.G2Affine{*rl.mt})
+				if err != nil {
+					return nil, err
+				}
+				for n, tk := range g.keys {
+					if tk.check(&f, &nht) {
+						match = append(match, WatchMatch{off + j, g.targets[n]})
+					}
+				}
+			}
+		}
+		off += len(group[i].rec)
+	}
+	sort.Slice(match, func(a, b int) bool {
+		if match[a].Record != match[b].Record {
+			return match[a].Record < match[b].Record
+		}
+		return match[a].Target < match[b].Target
+	})
+	return match, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTraceWatchlist(t *testing.T) {
+	ms := []*bls12381.G2Affine{getRandomG2(), getRandomG2(), getRandomG2()}
+
+	// each epoch holds target 0 at 0, an outsider at 1 and target 2 at 2;
+	// position 3 is target 1 in epoch 1 and an outsider otherwise
+	er := NewEpochRecords(benchSchedule)
+	for e := uint64(0); e < 3; e++ {
+		h, _ := benchSchedule.H(e)
+		targets := []*bls12381.G2Affine{ms[0], getRandomG2(), ms[2], getRandomG2()}
+		if e == 1 {
+			targets[3] = ms[1]
+		}
+		for _, m := range targets {
+			assert.Nil(t, er.Add(e, getRLight(m, h)))
+		}
+	}
+	groups, _ := er.Batches()
+	want := []WatchMatch{{0, 0}, {2, 2}, {4, 0}, {6, 2}, {7, 1}, {8, 0}, {10, 2}}
+
+	match, err := traceWatchlist(groups, traceR1Watchlist(groups, ms))
+	assert.Nil(t, err)
+	assert.Equal(t, want, match)
+
+	// tokens of separate traceR1 runs have their own ht and still match
+	bd := make(map[int][]*RBD)
+	for _, m := range ms {
+		for k, tk := range traceR1(groups, m) {
+			bd[k] = append(bd[k], tk)
+		}
+	}
+	match, err = traceWatchlist(groups, bd)
+	assert.Nil(t, err)
+	assert.Equal(t, want, match)
+
+	// the matches of a target are what traceSP finds for it alone
+	single, _ := traceSP(groups, traceR1(groups, ms[2]))
+	assert.Equal(t, []int{2, 6, 10}, single)
+
+	bd[1][0] = bd[0][0]
+	_, err = traceWatchlist(groups, bd)
+	assert.NotNil(t, err)
+	delete(bd, 1)
+	_, err = traceWatchlist(groups, bd)
+	assert.NotNil(t, err)
+}
+
+// BenchmarkTraceWatchlist compares one pass for a watchlist with one traceSP
+// pass per target
+func BenchmarkTraceWatchlist(b *testing.B) {
+	ms := make([]*bls12381.G2Affine, 16)
+	for i := range ms {
+		ms[i] = getRandomG2()
+	}
+	groups, err := GenerateRecordsLight(ms[0], 64, 2, 16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bd := traceR1Watchlist(groups, ms)
+	tds := make([]map[int]*RBD, len(ms))
+	for i, m := range ms {
+		tds[i] = traceR1(groups, m)
+	}
+	b.Run("traceSP", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, td := range tds {
+				if _, err := traceSP(groups, td); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("traceWatchlist", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := traceWatchlist(groups, bd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ require (
 	github.com/consensys/gnark v0.12.1-0.20250228122530-d2fa6c33bb0e
 	github.com/consensys/gnark-crypto v0.16.1-0.20250301001001-d2fa915f3fc7
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/crypto v0.35.0
 )
 
 require (
@@ -23,7 +24,6 @@ require (
 	github.com/ronanh/intcomp v1.1.1 // indirect
 	github.com/rs/zerolog v1.33.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
-	golang.org/x/crypto v0.35.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect